@@ -0,0 +1,66 @@
+package lame
+
+import (
+	"github.com/viert/go-lame/ape"
+)
+
+type apeItem struct {
+	key   string
+	value string
+}
+
+// SetWriteAPETag turns writing of an APEv2 tag on or off
+//  The tag is populated from the values set through ID3TagSet* methods
+//  and APETagSetItem. It's written after the audio and before the ID3v1 tag
+//  when WriteID3TagAutomatic is on, use APETag to write it yourself otherwise.
+//  Should be called before the first Write.
+func (e *Encoder) SetWriteAPETag(write bool) {
+	e.apeWrite = write
+}
+
+// WriteAPETag returns current APEv2 tag write flag
+func (e *Encoder) WriteAPETag() bool {
+	return e.apeWrite
+}
+
+// APETagSetItem sets a custom APEv2 text item, e.g. REPLAYGAIN_TRACK_GAIN
+//  An item with the same key set before is replaced, empty value removes it
+func (e *Encoder) APETagSetItem(key string, value string) {
+	for i, item := range e.apeItems {
+		if item.key == key {
+			e.apeItems = append(e.apeItems[:i], e.apeItems[i+1:]...)
+			break
+		}
+	}
+	if value != "" {
+		e.apeItems = append(e.apeItems, apeItem{key: key, value: value})
+	}
+}
+
+// APETag returns APEv2 tag
+//  An error is returned if any of the custom item keys is invalid
+func (e *Encoder) APETag() ([]byte, error) {
+	f := e.id3fields
+	tag := ape.New()
+	tag.SetText("Title", f.title)
+	tag.SetText("Artist", f.artist)
+	tag.SetText("Album", f.album)
+	tag.SetText("Year", f.year)
+	tag.SetText("Comment", f.comment)
+	tag.SetText("Track", f.track)
+	tag.SetText("Genre", f.genreName())
+	for _, item := range e.apeItems {
+		tag.SetText(item.key, item.value)
+	}
+	return tag.Bytes()
+}
+
+// writeAPETag writes APEv2 tag to the output
+func (e *Encoder) writeAPETag() error {
+	tag, err := e.APETag()
+	if err != nil {
+		return err
+	}
+	_, err = e.output.Write(tag)
+	return err
+}
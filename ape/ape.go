@@ -0,0 +1,294 @@
+// Package ape implements reading and writing of APEv2 tags
+package ape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	preamble       = "APETAGEX"
+	headerSize     = 32
+	id3v1TagSize   = 128
+	minKeySize     = 2
+	maxKeySize     = 255
+	itemHeaderSize = 8
+
+	// Version1 is APEv1 tag version, it's read but never written
+	Version1 = 1000
+	// Version2 is APEv2 tag version
+	Version2 = 2000
+)
+
+// Tag flags
+const (
+	flagHasHeader = 1 << 31
+	flagIsHeader  = 1 << 29
+
+	flagReadOnly  = 1
+	itemTypeShift = 1
+	itemTypeMask  = 3 << itemTypeShift
+)
+
+// Errors returned by the package
+var (
+	ErrNoTag       = errors.New("ape: no tag found")
+	ErrInvalidTag  = errors.New("ape: invalid tag")
+	ErrUnsupported = errors.New("ape: unsupported tag version")
+	ErrInvalidKey  = errors.New("ape: invalid item key")
+	ErrTagTooLarge = errors.New("ape: tag is too large")
+)
+
+// keys reserved by the specification
+var forbiddenKeys = []string{"ID3", "TAG", "OggS", "MP+"}
+
+// ItemType is the type of an item value
+type ItemType int
+
+// Item types
+const (
+	ItemText     ItemType = 0
+	ItemBinary   ItemType = 1
+	ItemExternal ItemType = 2 /* locator of external stored information */
+)
+
+// Item is a single tag item
+type Item struct {
+	Key      string
+	Value    []byte
+	Type     ItemType
+	ReadOnly bool
+}
+
+// Text returns the value of a text item
+//  Multiple values separated by null characters are joined with "/"
+func (i *Item) Text() string {
+	return strings.Replace(string(i.Value), "\x00", "/", -1)
+}
+
+// Tag represents an APE tag
+type Tag struct {
+	// Version is either Version1 or Version2
+	Version int
+	// Size is the total size of the tag including header and footer
+	Size  int
+	Items []Item
+}
+
+// New creates an empty APEv2 tag
+func New() *Tag {
+	return &Tag{Version: Version2}
+}
+
+// Read reads an APE tag located at the end of r
+//  An ID3v1 tag following the APE tag is skipped
+func Read(r io.ReadSeeker) (*Tag, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	if end >= id3v1TagSize {
+		marker := make([]byte, 3)
+		if _, err = r.Seek(end-id3v1TagSize, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err = io.ReadFull(r, marker); err != nil {
+			return nil, err
+		}
+		if string(marker) == "TAG" {
+			end -= id3v1TagSize
+		}
+	}
+	return ReadAt(r, end)
+}
+
+// ReadAt reads an APE tag which footer ends at offset end
+func ReadAt(r io.ReadSeeker, end int64) (*Tag, error) {
+	if end < headerSize {
+		return nil, ErrNoTag
+	}
+	if _, err := r.Seek(end-headerSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	footer := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, footer); err != nil {
+		return nil, err
+	}
+	version, size, count, flags, err := parseHeader(footer)
+	if err != nil {
+		return nil, err
+	}
+	if flags&flagIsHeader != 0 || size < headerSize || int64(size) > end {
+		return nil, ErrInvalidTag
+	}
+
+	t := &Tag{Version: version, Size: size}
+	if flags&flagHasHeader != 0 {
+		t.Size += headerSize
+	}
+
+	if _, err = r.Seek(end-int64(size), io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, size-headerSize)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if err = t.parseItems(data, count); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func parseHeader(b []byte) (version int, size int, count int, flags uint32, err error) {
+	if string(b[:len(preamble)]) != preamble {
+		err = ErrNoTag
+		return
+	}
+	version = int(binary.LittleEndian.Uint32(b[8:]))
+	size = int(binary.LittleEndian.Uint32(b[12:]))
+	count = int(binary.LittleEndian.Uint32(b[16:]))
+	flags = binary.LittleEndian.Uint32(b[20:])
+	if version != Version1 && version != Version2 {
+		err = ErrUnsupported
+	}
+	return
+}
+
+func (t *Tag) parseItems(data []byte, count int) error {
+	for i := 0; i < count; i++ {
+		if len(data) < itemHeaderSize {
+			return ErrInvalidTag
+		}
+		size := int(binary.LittleEndian.Uint32(data))
+		flags := binary.LittleEndian.Uint32(data[4:])
+		data = data[itemHeaderSize:]
+
+		end := bytes.IndexByte(data, 0)
+		if end < 0 || end+1+size > len(data) {
+			return ErrInvalidTag
+		}
+		item := Item{
+			Key:      string(data[:end]),
+			Value:    data[end+1 : end+1+size],
+			ReadOnly: flags&flagReadOnly != 0,
+		}
+		if t.Version == Version2 {
+			item.Type = ItemType(flags & itemTypeMask >> itemTypeShift)
+		}
+		t.Items = append(t.Items, item)
+		data = data[end+1+size:]
+	}
+	return nil
+}
+
+// Item returns an item by its key, keys are case-insensitive
+func (t *Tag) Item(key string) *Item {
+	for i := range t.Items {
+		if strings.EqualFold(t.Items[i].Key, key) {
+			return &t.Items[i]
+		}
+	}
+	return nil
+}
+
+// Text returns the value of a text item
+func (t *Tag) Text(key string) (string, bool) {
+	item := t.Item(key)
+	if item == nil || item.Type != ItemText {
+		return "", false
+	}
+	return item.Text(), true
+}
+
+// SetText sets a text item replacing an existing one with the same key
+//  An empty value removes the item
+func (t *Tag) SetText(key string, value string) {
+	if value == "" {
+		t.Remove(key)
+		return
+	}
+	t.Set(Item{Key: key, Value: []byte(value), Type: ItemText})
+}
+
+// Set sets an item replacing an existing one with the same key
+func (t *Tag) Set(item Item) {
+	if existing := t.Item(item.Key); existing != nil {
+		*existing = item
+		return
+	}
+	t.Items = append(t.Items, item)
+}
+
+// Remove removes an item by its key
+func (t *Tag) Remove(key string) {
+	items := t.Items[:0]
+	for _, item := range t.Items {
+		if !strings.EqualFold(item.Key, key) {
+			items = append(items, item)
+		}
+	}
+	t.Items = items
+}
+
+// Bytes encodes the tag as APEv2 with both header and footer
+func (t *Tag) Bytes() ([]byte, error) {
+	var items []byte
+	for _, item := range t.Items {
+		if err := validateKey(item.Key); err != nil {
+			return nil, err
+		}
+		var head [itemHeaderSize]byte
+		flags := uint32(item.Type) << itemTypeShift & itemTypeMask
+		if item.ReadOnly {
+			flags |= flagReadOnly
+		}
+		binary.LittleEndian.PutUint32(head[0:], uint32(len(item.Value)))
+		binary.LittleEndian.PutUint32(head[4:], flags)
+		items = append(items, head[:]...)
+		items = append(items, item.Key...)
+		items = append(items, 0)
+		items = append(items, item.Value...)
+	}
+
+	size := len(items) + headerSize
+	if uint64(size) > 1<<32-1 {
+		return nil, ErrTagTooLarge
+	}
+	buf := make([]byte, 0, size+headerSize)
+	buf = append(buf, header(size, len(t.Items), flagHasHeader|flagIsHeader)...)
+	buf = append(buf, items...)
+	buf = append(buf, header(size, len(t.Items), flagHasHeader)...)
+	return buf, nil
+}
+
+func header(size int, count int, flags uint32) []byte {
+	b := make([]byte, headerSize)
+	copy(b, preamble)
+	binary.LittleEndian.PutUint32(b[8:], Version2)
+	binary.LittleEndian.PutUint32(b[12:], uint32(size))
+	binary.LittleEndian.PutUint32(b[16:], uint32(count))
+	binary.LittleEndian.PutUint32(b[20:], flags)
+	return b
+}
+
+func validateKey(key string) error {
+	if len(key) < minKeySize || len(key) > maxKeySize {
+		return ErrInvalidKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return ErrInvalidKey
+		}
+	}
+	for _, forbidden := range forbiddenKeys {
+		if strings.EqualFold(key, forbidden) {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
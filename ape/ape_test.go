@@ -0,0 +1,71 @@
+package ape
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tag := New()
+	tag.SetText("Title", "Super Song")
+	tag.SetText("Artist", "First\x00Second")
+	tag.SetText("REPLAYGAIN_TRACK_GAIN", "-6.20 dB")
+	tag.Set(Item{Key: "Cover Art (Front)", Value: []byte("cover.jpg\x00\xff\xd8"), Type: ItemBinary})
+	tag.SetText("title", "Replaced Song")
+
+	data, err := tag.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id3v1 := make([]byte, id3v1TagSize)
+	copy(id3v1, "TAG")
+	file := bytes.Join([][]byte{[]byte("audio frames"), data, id3v1}, nil)
+
+	read, err := Read(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version != Version2 {
+		t.Errorf("version is %d, expected %d", read.Version, Version2)
+	}
+	if read.Size != len(data) {
+		t.Errorf("size is %d, expected %d", read.Size, len(data))
+	}
+	if len(read.Items) != 4 {
+		t.Fatalf("%d items read, expected 4", len(read.Items))
+	}
+	if title, _ := read.Text("TITLE"); title != "Replaced Song" {
+		t.Errorf("title is %q", title)
+	}
+	if artist, _ := read.Text("Artist"); artist != "First/Second" {
+		t.Errorf("artist is %q", artist)
+	}
+	if gain, _ := read.Text("ReplayGain_Track_Gain"); gain != "-6.20 dB" {
+		t.Errorf("replay gain is %q", gain)
+	}
+	cover := read.Item("Cover Art (Front)")
+	if cover == nil || cover.Type != ItemBinary || !bytes.HasSuffix(cover.Value, []byte{0xff, 0xd8}) {
+		t.Errorf("unexpected cover item %+v", cover)
+	}
+	if _, ok := read.Text("Cover Art (Front)"); ok {
+		t.Error("binary item is not expected to be returned as text")
+	}
+}
+
+func TestNoTag(t *testing.T) {
+	_, err := Read(bytes.NewReader(make([]byte, 300)))
+	if err != ErrNoTag {
+		t.Errorf("expected ErrNoTag, got %v", err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	for _, key := range []string{"a", "TAG", "Key\x01"} {
+		tag := New()
+		tag.SetText(key, "value")
+		if _, err := tag.Bytes(); err != ErrInvalidKey {
+			t.Errorf("key %q: expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package lame
+
+import (
+	"sync"
+)
+
+const (
+	// maxBlockSamples is the max number of samples per channel encoded at once
+	maxBlockSamples = 8192
+
+	// maxBlockAlignment is the size of a stereo 16-bit sample
+	maxBlockAlignment = bitDepth / 8 * 2
+
+	// From lame.h:
+	// The required mp3buf_size can be computed from num_samples,
+	// samplerate and encoding rate, but here is a worst case estimate:
+	//
+	// mp3buf_size in bytes = 1.25*num_samples + 7200
+	//
+	// the same buffer is large enough for lame_encode_flush as well
+	mp3bufSize = maxBlockSamples*5/4 + 7200
+
+	// pcmbufSize is the size of the buffer ReadFrom reads input to
+	pcmbufSize = maxBlockSamples * maxBlockAlignment
+)
+
+// mp3bufPool keeps mp3 buffers of closed encoders for the new ones
+var mp3bufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, mp3bufSize)
+		return &buf
+	},
+}
+
+// pcmbufPool keeps input buffers used by ReadFrom
+var pcmbufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, pcmbufSize)
+		return &buf
+	},
+}
+
+// mp3buffer returns the encoder's mp3 buffer taking one from the pool
+// on the first call
+func (e *Encoder) mp3buffer() []byte {
+	if e.mp3buf == nil {
+		e.mp3buf = mp3bufPool.Get().(*[]byte)
+	}
+	return *e.mp3buf
+}
+
+// pcmbuffer returns the encoder's input buffer taking one from the pool
+// on the first call
+func (e *Encoder) pcmbuffer() []byte {
+	if e.pcmbuf == nil {
+		e.pcmbuf = pcmbufPool.Get().(*[]byte)
+	}
+	return *e.pcmbuf
+}
+
+// releaseBuffers returns the encoder's buffers to the pools
+func (e *Encoder) releaseBuffers() {
+	if e.mp3buf != nil {
+		mp3bufPool.Put(e.mp3buf)
+		e.mp3buf = nil
+	}
+	if e.pcmbuf != nil {
+		pcmbufPool.Put(e.pcmbuf)
+		e.pcmbuf = nil
+	}
+}
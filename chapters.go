@@ -0,0 +1,145 @@
+package lame
+
+/*
+#cgo LDFLAGS: -lmp3lame
+#include <lame/lame.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/viert/go-lame/id3"
+)
+
+const (
+	// encoder delay lame reports for the default settings,
+	// used until lame_init_params is called
+	defaultEncoderDelay = 576
+
+	tocElementID = "toc"
+)
+
+// Chapter describes a chapter written as an ID3v2 CHAP frame
+type Chapter struct {
+	// ID is the chapter element id, "chp<index>" is used if empty
+	ID    string
+	Title string
+	// Start and End are offsets from the beginning of the input audio
+	Start time.Duration
+	End   time.Duration
+	// Image is an optional chapter image
+	//  ImageMIMEType should be set accordingly, e.g. "image/jpeg"
+	Image         []byte
+	ImageMIMEType string
+}
+
+type chapter struct {
+	Chapter
+	inSamples   bool
+	startSample int64
+	endSample   int64
+}
+
+// AddChapter adds a chapter to the ID3v2 tag
+//  Chapters are written along with the frames lame generates and a table of
+//  contents listing all of them in order. Start and End are converted to
+//  milliseconds shifted by the encoder delay so they point to the same audio
+//  in the decoded stream.
+//  Chapters must be added before the first Write as the tag is written
+//  at the beginning of the stream.
+func (e *Encoder) AddChapter(ch Chapter) error {
+	if ch.Start < 0 || ch.End < ch.Start {
+		return fmt.Errorf("invalid chapter time range %v-%v", ch.Start, ch.End)
+	}
+	return e.addChapter(chapter{Chapter: ch})
+}
+
+// AddChapterSamples adds a chapter with the time range given in input samples
+//  Start and End fields of ch are ignored, see AddChapter for details.
+func (e *Encoder) AddChapterSamples(ch Chapter, start int64, end int64) error {
+	if start < 0 || end < start {
+		return fmt.Errorf("invalid chapter sample range %d-%d", start, end)
+	}
+	return e.addChapter(chapter{Chapter: ch, inSamples: true, startSample: start, endSample: end})
+}
+
+func (e *Encoder) addChapter(ch chapter) error {
+	if e.started {
+		return fmt.Errorf("chapters must be added before the first write")
+	}
+	e.chapters = append(e.chapters, ch)
+	return nil
+}
+
+// chapterFrames returns CTOC and CHAP frames for the chapters added
+func (e *Encoder) chapterFrames() []id3.Frame {
+	if len(e.chapters) == 0 {
+		return nil
+	}
+
+	toc := &id3.TOCFrame{ElementID: tocElementID, TopLevel: true, Ordered: true}
+	frames := []id3.Frame{toc}
+	for i, ch := range e.chapters {
+		id := ch.ID
+		if id == "" {
+			id = fmt.Sprintf("chp%d", i)
+		}
+		toc.ChildElementIDs = append(toc.ChildElementIDs, id)
+
+		start, end := ch.Start, ch.End
+		if ch.inSamples {
+			start, end = e.samplesDuration(ch.startSample), e.samplesDuration(ch.endSample)
+		}
+		f := &id3.ChapterFrame{
+			ElementID:   id,
+			StartTime:   e.chapterTime(start),
+			EndTime:     e.chapterTime(end),
+			StartOffset: id3.NoOffset,
+			EndOffset:   id3.NoOffset,
+		}
+		if ch.Title != "" {
+			f.Frames = append(f.Frames, &id3.TextFrame{FrameID: "TIT2", Values: []string{ch.Title}})
+		}
+		if len(ch.Image) > 0 {
+			f.Frames = append(f.Frames, &id3.PictureFrame{
+				MIMEType:    ch.ImageMIMEType,
+				PictureType: id3.PictureOther,
+				Data:        ch.Image,
+			})
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// samplesDuration converts the number of input samples to duration
+func (e *Encoder) samplesDuration(samples int64) time.Duration {
+	rate := int64(e.InSamplerate())
+	return time.Duration(samples * int64(time.Second) / rate)
+}
+
+// chapterTime converts an input audio offset into milliseconds of the decoded stream
+func (e *Encoder) chapterTime(d time.Duration) uint32 {
+	delay := time.Duration(int64(e.encoderDelay()) * int64(time.Second) / int64(e.outSamplerate()))
+	return uint32((d + delay) / time.Millisecond)
+}
+
+// encoderDelay returns the encoder delay in output samples
+func (e *Encoder) encoderDelay() int {
+	if !e.initialized {
+		return defaultEncoderDelay
+	}
+	return int(C.lame_get_encoder_delay(e.lgf))
+}
+
+// outSamplerate returns the output sample rate falling back
+// to the input one until lame chooses it in lame_init_params
+func (e *Encoder) outSamplerate() int {
+	rate := int(C.lame_get_out_samplerate(e.lgf))
+	if rate == 0 {
+		rate = e.InSamplerate()
+	}
+	return rate
+}
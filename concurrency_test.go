@@ -0,0 +1,80 @@
+package lame
+
+import (
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// these tests are meant to be run with the race detector
+
+func TestConcurrentWrites(t *testing.T) {
+	c := new(counter)
+	enc := NewEncoder(c)
+	input := pcmInput(4608)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				enc.Write(input)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.cnt == 0 {
+		t.Error("no data encoded")
+	}
+}
+
+func TestConcurrentWriteAndClose(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		enc := NewEncoder(ioutil.Discard)
+		input := pcmInput(4608)
+
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < 20; k++ {
+					if _, err := enc.Write(input); err == ErrEncoderClosed {
+						return
+					}
+					enc.Flush()
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			enc.Close()
+		}()
+		wg.Wait()
+		enc.Close()
+	}
+}
+
+func TestFinalizerDuringEncoding(t *testing.T) {
+	input := pcmInput(1 << 16)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				// the encoder is unreachable as soon as Write returns
+				NewEncoder(ioutil.Discard).Write(input)
+				runtime.GC()
+			}
+		}()
+	}
+	wg.Wait()
+	runtime.GC()
+}
@@ -0,0 +1,58 @@
+package lame
+
+// EncoderConfig describes the encoding parameters of an Encoder
+//  Zero values leave lame defaults, so stereo mode and quality 0 which are
+//  zero in lame too can't be requested with EncoderConfig, use SetMode and
+//  SetQuality instead. EncoderConfig is comparable and can be used as a map key.
+type EncoderConfig struct {
+	NumChannels   int
+	InSamplerate  int
+	OutSamplerate int
+	// Preset is applied first so the other values override it
+	Preset             PresetMode
+	VBR                VBRMode
+	VBRMeanBitrateKbps int
+	Brate              int
+	Mode               MpegMode
+	Quality            int
+}
+
+// Configure applies the non-zero values of the config to the encoder
+func (e *Encoder) Configure(cfg EncoderConfig) error {
+	if cfg.Preset != 0 {
+		if err := e.SetPreset(cfg.Preset); err != nil {
+			return err
+		}
+	}
+	if cfg.VBR != VBROff {
+		if err := e.SetVBR(cfg.VBR); err != nil {
+			return err
+		}
+	}
+	if cfg.Mode != 0 {
+		if err := e.SetMode(cfg.Mode); err != nil {
+			return err
+		}
+	}
+
+	setters := []struct {
+		setter func(int) error
+		value  int
+	}{
+		{e.SetNumChannels, cfg.NumChannels},
+		{e.SetInSamplerate, cfg.InSamplerate},
+		{e.SetOutSamplerate, cfg.OutSamplerate},
+		{e.SetVBRMeanBitrateKbps, cfg.VBRMeanBitrateKbps},
+		{e.SetBrate, cfg.Brate},
+		{e.SetQuality, cfg.Quality},
+	}
+	for _, s := range setters {
+		if s.value == 0 {
+			continue
+		}
+		if err := s.setter(s.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
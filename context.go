@@ -0,0 +1,118 @@
+package lame
+
+/*
+#cgo LDFLAGS: -lmp3lame
+#include <lame/lame.h>
+*/
+import "C"
+
+import (
+	"context"
+	"io"
+)
+
+// WithContext makes the encoder abort when ctx is done
+//  Write and ReadFrom check ctx between blocks of input, Flush and Close
+//  check it before flushing. Once ctx is done the lame handle is released
+//  without flushing and ctx.Err() is returned.
+func WithContext(ctx context.Context) Option {
+	return func(e *Encoder) {
+		e.ctx = ctx
+	}
+}
+
+// EncodeContext encodes all the PCM data from r and flushes the encoder
+//  Encoding is aborted and the lame handle is released as soon as ctx is done,
+//  see WithContext. Reads from r are made in a goroutine without holding the
+//  encoder lock, so neither cancellation nor Close waits for a blocked read.
+//  A read which never returns can't be interrupted though, its goroutine is
+//  left behind until r returns. The encoder is not closed on success.
+func EncodeContext(ctx context.Context, enc *Encoder, r io.Reader) (int64, error) {
+	buf := make([]byte, maxBlockSamples*maxBlockAlignment)
+	var total int64
+	for {
+		// the channel is buffered so an abandoned read doesn't block forever
+		reads := make(chan readResult, 1)
+		go func() {
+			n, err := r.Read(buf)
+			reads <- readResult{n, err}
+		}()
+
+		var res readResult
+		select {
+		case <-ctx.Done():
+			enc.mu.Lock()
+			enc.abort()
+			enc.mu.Unlock()
+			return total, ctx.Err()
+		case res = <-reads:
+		}
+
+		total += int64(res.n)
+		if res.n > 0 {
+			if err := enc.writeContext(ctx, buf[:res.n]); err != nil {
+				return total, err
+			}
+		}
+		if res.err == io.EOF {
+			break
+		}
+		if res.err != nil {
+			return total, res.err
+		}
+	}
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+	defer enc.setContext(ctx)()
+	_, err := enc.flush()
+	return total, err
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+// writeContext encodes p with ctx checked between the blocks
+func (e *Encoder) writeContext(ctx context.Context, p []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.setContext(ctx)()
+	_, err := e.write(p)
+	return err
+}
+
+// setContext replaces the encoder context returning a function restoring it
+func (e *Encoder) setContext(ctx context.Context) func() {
+	prev := e.ctx
+	e.ctx = ctx
+	return func() {
+		e.ctx = prev
+	}
+}
+
+// check returns an error if the encoder can't be used anymore
+//  The lame handle is released as soon as the context is done
+func (e *Encoder) check() error {
+	if e.ctx != nil {
+		if err := e.ctx.Err(); err != nil {
+			e.abort()
+			return err
+		}
+	}
+	if e.closed {
+		return ErrEncoderClosed
+	}
+	return nil
+}
+
+// abort closes the encoder without flushing
+func (e *Encoder) abort() {
+	if e.closed {
+		return
+	}
+	C.lame_close(e.lgf)
+	e.releaseBuffers()
+	e.closed = true
+}
@@ -0,0 +1,141 @@
+package lame
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// cancelingReader cancels the context after the given number of reads
+type cancelingReader struct {
+	r      io.Reader
+	reads  int
+	cancel context.CancelFunc
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	r.reads--
+	if r.reads == 0 {
+		r.cancel()
+	}
+	return r.r.Read(p)
+}
+
+func TestEncodeContext(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	n, err := EncodeContext(context.Background(), enc, bytes.NewReader(pcmInput(10000)))
+	if err != nil || n != 10000 {
+		t.Errorf("EncodeContext returned %d, %v", n, err)
+	}
+	if err = enc.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	enc := NewEncoder(ioutil.Discard)
+	r := &cancelingReader{r: bytes.NewReader(pcmInput(1 << 20)), reads: 3, cancel: cancel}
+	n, err := EncodeContext(ctx, enc, r)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if n >= 1<<20 {
+		t.Errorf("the whole input is read in spite of cancellation")
+	}
+	if !enc.closed {
+		t.Error("encoder is expected to be closed on cancellation")
+	}
+	if _, err = enc.Write(pcmInput(100)); err != ErrEncoderClosed {
+		t.Errorf("expected ErrEncoderClosed, got %v", err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	enc := NewEncoder(ioutil.Discard, WithContext(ctx))
+	if _, err := enc.Write(pcmInput(10000)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := enc.Write(pcmInput(10000)); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Errorf("Close after abort returned %v", err)
+	}
+}
+
+// blockingReader blocks until released
+type blockingReader struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	close(r.started)
+	<-r.release
+	return 0, io.EOF
+}
+
+func TestEncodeContextBlockedRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	enc := NewEncoder(ioutil.Discard)
+	r := &blockingReader{started: make(chan struct{}), release: make(chan struct{})}
+	defer close(r.release)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := EncodeContext(ctx, enc, r)
+		done <- err
+	}()
+	<-r.started
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("EncodeContext is blocked by the read")
+	}
+	if err := enc.Close(); err != nil {
+		t.Errorf("Close after abort returned %v", err)
+	}
+}
+
+func TestEncodeContextCloseDuringRead(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	r := &blockingReader{started: make(chan struct{}), release: make(chan struct{})}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := EncodeContext(context.Background(), enc, r)
+		done <- err
+	}()
+	<-r.started
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- enc.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close is blocked by the read")
+	}
+
+	close(r.release)
+	if err := <-done; err != ErrEncoderClosed {
+		t.Errorf("expected ErrEncoderClosed, got %v", err)
+	}
+}
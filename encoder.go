@@ -7,31 +7,92 @@ package lame
 import "C"
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"io"
 	"runtime"
+	"sync"
 	"unsafe"
+
+	"github.com/viert/go-lame/id3"
+	"github.com/viert/go-lame/mp3"
 )
 
 // Encoder represents a Writer interface to lame encoder
+//  Write, ReadFrom, Flush and Close are safe for concurrent use, the setters
+//  are expected to be called before encoding starts.
 type Encoder struct {
-	lgf          lameglobal
-	output       *bufio.Writer
-	closed       bool
-	initialized  bool
-	inremainder  []byte
-	outremainder []byte
+	lgf             lameglobal
+	params          []func(lameglobal) C.int
+	output          *output
+	closed          bool
+	initialized     bool
+	started         bool
+	inremainder     [maxBlockAlignment]byte
+	inremainderSize int
+	mp3buf          *[]byte
+	pcmbuf          *[]byte
+
+	// tags are written by Encoder instead of lame when they contain
+	// frames lame can't produce itself or an APE tag is requested
+	id3auto    bool
+	id3custom  bool
+	id3v1Only  bool
+	id3v2Only  bool
+	id3version int
+	id3fields  id3Fields
+	id3frames  []id3.Frame
+	chapters   []chapter
+	apeWrite   bool
+	apeItems   []apeItem
+
+	ctx context.Context
+
+	// mu serializes encoding, flushing and closing
+	mu sync.Mutex
+
+	// frames splits the output when a frame handler is set
+	frames *mp3.FrameWriter
+
+	// pool the encoder belongs to and its config there,
+	// pool and idle are guarded by the pool mutex
+	pool    *Pool
+	poolKey EncoderConfig
+	idle    bool
+}
+
+// ErrEncoderClosed is returned on using an encoder after Close
+var ErrEncoderClosed = errors.New("lame: encoder is closed")
+
+// Option configures an Encoder on creation
+type Option func(*Encoder)
+
+// WithOutputBufferSize sets the size of the buffer encoded data is collected
+// in before it's written to the underlying writer
+//  0 disables buffering, DefaultOutputBufferSize is used by default
+func WithOutputBufferSize(size int) Option {
+	return func(e *Encoder) {
+		e.output = newOutput(e.output.w, size)
+	}
 }
 
 // NewEncoder creates a new encoder
-func NewEncoder(w io.Writer) *Encoder {
+func NewEncoder(w io.Writer, opts ...Option) *Encoder {
 	e := &Encoder{
-		lgf:          C.lame_init(),
-		output:       bufio.NewWriter(w),
-		initialized:  false,
-		closed:       false,
-		inremainder:  nil,
-		outremainder: nil,
+		lgf:         C.lame_init(),
+		output:      newOutput(w, DefaultOutputBufferSize),
+		initialized: false,
+		closed:      false,
+		id3auto:     true,
+		id3version:  3,
+		id3fields:   id3Fields{padding: defaultID3Padding},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.frames != nil {
+		e.output = newOutput(e.frameSink(w), 0)
+		e.SetWriteVBRTag(false)
 	}
 	runtime.SetFinalizer(e, finalize)
 	return e
@@ -39,19 +100,59 @@ func NewEncoder(w io.Writer) *Encoder {
 
 func finalize(e *Encoder) {
 	e.Close()
+	if e.pool != nil {
+		// the encoder is lost without returning to the pool
+		e.pool.discard(e)
+	}
+}
+
+// setParam calls a lame setter and keeps it to be replayed on a new handle
+//  lame_init_bitstream doesn't apply parameters changed after the first
+//  stream, so the handle is rebuilt when one is set between the streams.
+func (e *Encoder) setParam(set func(lameglobal) C.int) error {
+	if e.initialized && !e.started && !e.closed {
+		if err := e.rebuild(); err != nil {
+			return err
+		}
+	}
+	res := int(set(e.lgf))
+	if res == 0 {
+		e.params = append(e.params, set)
+	}
+	return convError(res)
+}
+
+// rebuild replaces the lame handle with a new one having the same parameters
+//  The tags set on the old handle are dropped.
+func (e *Encoder) rebuild() error {
+	C.lame_close(e.lgf)
+	e.lgf = C.lame_init()
+	if e.lgf == nil {
+		e.releaseBuffers()
+		e.closed = true
+		return ErrorMalloc
+	}
+	for _, set := range e.params {
+		set(e.lgf)
+	}
+	e.initialized = false
+	e.InitID3Tag()
+	return nil
 }
 
 // SetVBR sets vbr mode
 func (e *Encoder) SetVBR(mode VBRMode) error {
-	res := int(C.lame_set_VBR(e.lgf, C.vbr_mode(mode)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_VBR(lgf, C.vbr_mode(mode))
+	})
 }
 
 // SetVBRMeanBitrateKbps sets VBR mean bitrate
 //  Ignored unless VBRABR mode is used
 func (e *Encoder) SetVBRMeanBitrateKbps(kbps int) error {
-	res := int(C.lame_set_VBR_mean_bitrate_kbps(e.lgf, C.int(kbps)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_VBR_mean_bitrate_kbps(lgf, C.int(kbps))
+	})
 }
 
 // VBRMeanBitrateKbps returns VBR mean bitrate
@@ -62,8 +163,9 @@ func (e *Encoder) VBRMeanBitrateKbps() int {
 // SetVBRMinBitrateKbps sets min bitrate
 // I gnored unless VBRABR mode is used
 func (e *Encoder) SetVBRMinBitrateKbps(kbps int) error {
-	res := int(C.lame_set_VBR_min_bitrate_kbps(e.lgf, C.int(kbps)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_VBR_min_bitrate_kbps(lgf, C.int(kbps))
+	})
 }
 
 // VBRMinBitrateKbps returns VBR mean bitrate
@@ -74,8 +176,9 @@ func (e *Encoder) VBRMinBitrateKbps() int {
 // SetVBRMaxBitrateKbps sets max bitrate
 //  Ignored unless VBRABR mode is used
 func (e *Encoder) SetVBRMaxBitrateKbps(kbps int) error {
-	res := int(C.lame_set_VBR_max_bitrate_kbps(e.lgf, C.int(kbps)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_VBR_max_bitrate_kbps(lgf, C.int(kbps))
+	})
 }
 
 // VBRMaxBitrateKbps returns VBR mean bitrate
@@ -90,8 +193,9 @@ func (e *Encoder) SetVBRHardMin(enforce bool) error {
 	if enforce {
 		value = 1
 	}
-	res := int(C.lame_set_VBR_hard_min(e.lgf, C.int(value)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_VBR_hard_min(lgf, C.int(value))
+	})
 }
 
 // VBRHardMin returns enforced min bitrate value
@@ -101,8 +205,9 @@ func (e *Encoder) VBRHardMin() bool {
 
 // SetVBRQuality sets VBR quality level.  0=highest  9=lowest, Range [0,...,10[
 func (e *Encoder) SetVBRQuality(quality float64) error {
-	res := int(C.lame_set_VBR_quality(e.lgf, C.float(quality)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_VBR_quality(lgf, C.float(quality))
+	})
 }
 
 // SetLowPassFrequency applies lowpass filtering to frequency in Hz
@@ -110,8 +215,9 @@ func (e *Encoder) SetVBRQuality(quality float64) error {
 //  -1 - disable lowpass
 //  default is 0
 func (e *Encoder) SetLowPassFrequency(frequency int) error {
-	res := int(C.lame_set_lowpassfreq(e.lgf, C.int(frequency)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_lowpassfreq(lgf, C.int(frequency))
+	})
 }
 
 // LowPassFrequency returns current lowpass frequency value
@@ -122,8 +228,9 @@ func (e *Encoder) LowPassFrequency() int {
 // SetLowPassWidth sets the width of transition band in Hz
 //  default = one polyphase filter band
 func (e *Encoder) SetLowPassWidth(frequency int) error {
-	res := int(C.lame_set_lowpasswidth(e.lgf, C.int(frequency)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_lowpasswidth(lgf, C.int(frequency))
+	})
 }
 
 // LowPassWidth returns current lowpass width value
@@ -136,8 +243,9 @@ func (e *Encoder) LowPassWidth() int {
 //  -1 - disable lowpass
 //  default is 0
 func (e *Encoder) SetHighPassFrequency(frequency int) error {
-	res := int(C.lame_set_highpassfreq(e.lgf, C.int(frequency)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_highpassfreq(lgf, C.int(frequency))
+	})
 }
 
 // HighPassFrequency returns current highpass frequency value
@@ -148,8 +256,9 @@ func (e *Encoder) HighPassFrequency() int {
 // SetHighPassWidth sets the width of transition band in Hz
 //  default = one polyphase filter band
 func (e *Encoder) SetHighPassWidth(frequency int) error {
-	res := int(C.lame_set_highpasswidth(e.lgf, C.int(frequency)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_highpasswidth(lgf, C.int(frequency))
+	})
 }
 
 // HighPassWidth returns current highpass width value
@@ -160,8 +269,9 @@ func (e *Encoder) HighPassWidth() int {
 // SetNumChannels sets number of channels in input stream
 //  default is 2
 func (e *Encoder) SetNumChannels(num int) error {
-	res := int(C.lame_set_num_channels(e.lgf, C.int(num)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_num_channels(lgf, C.int(num))
+	})
 }
 
 // NumChannels returns current input numchannels value
@@ -172,8 +282,9 @@ func (e *Encoder) NumChannels() int {
 // SetNumSamples sets number of samples.
 //  default = 2^32-1
 func (e *Encoder) SetNumSamples(numSamples uint32) error {
-	res := int(C.lame_set_num_samples(e.lgf, C.ulong(numSamples)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_num_samples(lgf, C.ulong(numSamples))
+	})
 }
 
 // NumSamples gets number of samples
@@ -184,8 +295,9 @@ func (e *Encoder) NumSamples() uint32 {
 // SetInSamplerate sets input sample rate in Hz
 //  default is 44100
 func (e *Encoder) SetInSamplerate(sampleRate int) error {
-	res := int(C.lame_set_in_samplerate(e.lgf, C.int(sampleRate)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_in_samplerate(lgf, C.int(sampleRate))
+	})
 }
 
 // InSamplerate returns current input sample rate configured
@@ -193,11 +305,25 @@ func (e *Encoder) InSamplerate() int {
 	return int(C.lame_get_in_samplerate(e.lgf))
 }
 
+// SetOutSamplerate sets output sample rate in Hz
+//  default is 0 - lame picks the best one for the bitrate
+func (e *Encoder) SetOutSamplerate(sampleRate int) error {
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_out_samplerate(lgf, C.int(sampleRate))
+	})
+}
+
+// OutSamplerate returns current output sample rate configured
+func (e *Encoder) OutSamplerate() int {
+	return int(C.lame_get_out_samplerate(e.lgf))
+}
+
 // SetBrate sets one of brate compression ratio.
 //  default is compression ratio of 11
 func (e *Encoder) SetBrate(brate int) error {
-	res := int(C.lame_set_brate(e.lgf, C.int(brate)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_brate(lgf, C.int(brate))
+	})
 }
 
 // Brate returns current brate compression ratio
@@ -209,8 +335,53 @@ func (e *Encoder) Brate() int {
 //  mode = 0,1,2,3 = stereo, jstereo, dual channel (not supported), mono
 //  default: lame picks based on compression ration and input channels
 func (e *Encoder) SetMode(mode MpegMode) error {
-	res := int(C.lame_set_mode(e.lgf, C.MPEG_mode(mode)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_mode(lgf, C.MPEG_mode(mode))
+	})
+}
+
+// SetWriteVBRTag turns the Xing/Info VBR tag frame on or off
+//  default is on, the frame is written at the beginning of the stream
+//  and filled in by LameTagFrame
+func (e *Encoder) SetWriteVBRTag(write bool) error {
+	var value int
+	if write {
+		value = 1
+	}
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_bWriteVbrTag(lgf, C.int(value))
+	})
+}
+
+// WriteVBRTag returns current VBR tag frame write flag
+func (e *Encoder) WriteVBRTag() bool {
+	return int(C.lame_get_bWriteVbrTag(e.lgf)) == 1
+}
+
+// SetPreset applies one of lame presets, e.g. PresetV2 or an ABR bitrate in kbps
+//  Presets set many parameters at once, the values set after override them
+func (e *Encoder) SetPreset(preset PresetMode) error {
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_preset(lgf, C.int(preset))
+	})
+}
+
+// SetDisableReservoir turns the bit reservoir off
+//  Frames don't borrow bits from the previous ones, so the stream can be cut
+//  at any frame and decoded from there, e.g. into HLS segments
+func (e *Encoder) SetDisableReservoir(disable bool) error {
+	var value int
+	if disable {
+		value = 1
+	}
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_disable_reservoir(lgf, C.int(value))
+	})
+}
+
+// DisableReservoir returns true if the bit reservoir is off
+func (e *Encoder) DisableReservoir() bool {
+	return int(C.lame_get_disable_reservoir(e.lgf)) == 1
 }
 
 // SetQuality chooses internal algorithm selection.
@@ -221,8 +392,9 @@ func (e *Encoder) SetMode(mode MpegMode) error {
 //                5     good quality, fast
 //                7     ok quality, really fast
 func (e *Encoder) SetQuality(quality int) error {
-	res := int(C.lame_set_quality(e.lgf, C.int(quality)))
-	return convError(res)
+	return e.setParam(func(lgf lameglobal) C.int {
+		return C.lame_set_quality(lgf, C.int(quality))
+	})
 }
 
 // Quality returns current quality value
@@ -230,68 +402,205 @@ func (e *Encoder) Quality() int {
 	return int(C.lame_get_quality(e.lgf))
 }
 
+// initParams starts a stream calling lame_init_params for the first one
+// and lame_init_bitstream for the ones started after Reset or NextTrack
 func (e *Encoder) initParams() error {
-	if e.initialized {
+	if e.started {
 		return nil
 	}
-	err := convError(int(C.lame_init_params(e.lgf)))
-	if err == nil {
-		e.initialized = true
+	e.id3custom = e.id3auto && (e.id3Managed() || e.apeWrite)
+	automatic := 0
+	if e.id3auto && !e.id3custom {
+		automatic = 1
+	}
+	C.lame_set_write_id3tag_automatic(e.lgf, C.int(automatic))
+
+	var err error
+	if e.initialized {
+		err = convError(int(C.lame_init_bitstream(e.lgf)))
+	} else {
+		err = convError(int(C.lame_init_params(e.lgf)))
+	}
+	if err != nil {
+		return err
+	}
+	e.initialized = true
+	e.started = true
+	if e.frames != nil {
+		e.frames.Delay = e.encoderDelay()
+	}
+	if e.id3custom {
+		err = e.writeID3V2Tag()
 	}
 	return err
 }
 
 // Write implements a default Writer interface
+//  The returned count is the number of input bytes consumed by the encoder.
+//  Input is encoded in blocks of at most 8192 samples per channel. If writing
+//  encoded data to the underlying writer fails, Write stops after the block
+//  which has been encoded already, the encoded data is kept and written
+//  on the next Write or Flush.
 func (e *Encoder) Write(p []byte) (int, error) {
-	var n int
-	var err error
-
-	// Write should always return the input data size if there was no error
-	inputDataSize := len(p)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.write(p)
+}
 
-	if !e.initialized {
-		e.initParams()
+func (e *Encoder) write(p []byte) (int, error) {
+	if err := e.check(); err != nil {
+		return 0, err
 	}
-
-	if e.inremainder != nil {
-		p = append(e.inremainder, p...)
+	if !e.started {
+		if err := e.initParams(); err != nil {
+			return 0, err
+		}
 	}
-
 	if len(p) == 0 {
 		return 0, nil
 	}
 
 	blockAlignment := bitDepth / 8 * e.NumChannels() // 2 bytes per channel
+	consumed := 0
+
+	if e.inremainderSize > 0 {
+		// complete the sample started by the previous Write
+		k := copy(e.inremainder[e.inremainderSize:blockAlignment], p)
+		e.inremainderSize += k
+		consumed += k
+		if e.inremainderSize < blockAlignment {
+			return consumed, nil
+		}
+		e.inremainderSize = 0
+		mp3, err := e.encode(e.inremainder[:blockAlignment], blockAlignment)
+		if err == nil {
+			_, err = e.output.Write(mp3)
+		}
+		if err != nil {
+			return consumed, err
+		}
+	}
+
+	p = p[consumed:]
 	bytesRemain := len(p) % blockAlignment
-	if bytesRemain > 0 {
-		e.inremainder = p[len(p)-bytesRemain : len(p)]
-		p = p[0 : len(p)-bytesRemain]
-	} else {
-		e.inremainder = nil
+	tail := p[len(p)-bytesRemain:]
+	p = p[:len(p)-bytesRemain]
+
+	blockSize := maxBlockSamples * blockAlignment
+	for len(p) > 0 {
+		if err := e.check(); err != nil {
+			return consumed, err
+		}
+		block := p
+		if len(block) > blockSize {
+			block = block[:blockSize]
+		}
+		mp3, err := e.encode(block, blockAlignment)
+		if err != nil {
+			return consumed, err
+		}
+		consumed += len(block)
+		if _, err = e.output.Write(mp3); err != nil {
+			// the block is encoded already, the output keeps the data
+			return consumed, err
+		}
+		p = p[len(block):]
+	}
+
+	// the trailing part of a sample is kept until the next Write
+	e.inremainderSize = copy(e.inremainder[:], tail)
+	consumed += e.inremainderSize
+	return consumed, nil
+}
+
+// ReadFrom implements io.ReaderFrom so io.Copy(enc, r) reads input
+// directly into the encoder's buffer
+//  The buffer holds a whole number of lame frames, lame_get_framesize
+//  samples each. The returned count is the number of bytes read from r,
+//  io.EOF is not reported as an error.
+func (e *Encoder) ReadFrom(r io.Reader) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.readFrom(r)
+}
+
+func (e *Encoder) readFrom(r io.Reader) (int64, error) {
+	if err := e.check(); err != nil {
+		return 0, err
+	}
+	if !e.started {
+		if err := e.initParams(); err != nil {
+			return 0, err
+		}
 	}
 
-	//
-	// From lame.h:
-	// The required mp3buf_size can be computed from num_samples,
-	// samplerate and encoding rate, but here is a worst case estimate:
-	//
-	// mp3buf_size in bytes = 1.25*num_samples + 7200
-	//
-	numSamples := len(p) / blockAlignment
-	estimatedSize := int(1.25*float64(numSamples)) + 7200
-	o := make([]byte, estimatedSize)
+	blockAlignment := bitDepth / 8 * e.NumChannels()
+	frameSize := int(C.lame_get_framesize(e.lgf)) * blockAlignment
+	pcm := e.pcmbuffer()
+	if frameSize > 0 && frameSize <= len(pcm) {
+		pcm = pcm[:len(pcm)/frameSize*frameSize]
+	}
 
-	cp := (*C.short)(unsafe.Pointer(&p[0]))
-	co := (*C.uchar)(unsafe.Pointer(&o[0]))
+	// the sample started by the previous Write goes first
+	filled := copy(pcm, e.inremainder[:e.inremainderSize])
+	e.inremainderSize = 0
+
+	var total int64
+	for {
+		if err := e.check(); err != nil {
+			return total, err
+		}
+		n, rerr := r.Read(pcm[filled:])
+		total += int64(n)
+		filled += n
+
+		// keep reading until the buffer is full unless the input is over
+		if filled < len(pcm) && rerr == nil {
+			continue
+		}
+
+		aligned := filled - filled%blockAlignment
+		if aligned > 0 {
+			mp3, err := e.encode(pcm[:aligned], blockAlignment)
+			if err == nil {
+				_, err = e.output.Write(mp3)
+			}
+			if err != nil {
+				return total, err
+			}
+		}
+		filled = copy(pcm, pcm[aligned:filled])
+
+		if rerr != nil {
+			// less than a sample is left, it's kept for the next Write
+			e.inremainderSize = copy(e.inremainder[:], pcm[:filled])
+			if rerr == io.EOF {
+				rerr = nil
+			}
+			return total, rerr
+		}
+	}
+}
 
-	if e.NumChannels() == 1 {
+// encode encodes a block of whole samples
+//  The returned slice points to the encoder's mp3 buffer and is valid
+//  until the next call.
+func (e *Encoder) encode(block []byte, blockAlignment int) ([]byte, error) {
+	var n int
+	numSamples := len(block) / blockAlignment
+	mp3buf := e.mp3buffer()
+
+	cp := (*C.short)(unsafe.Pointer(&block[0]))
+	co := (*C.uchar)(unsafe.Pointer(&mp3buf[0]))
+
+	if blockAlignment == bitDepth/8 {
 		n = int(C.lame_encode_buffer(
 			e.lgf,
 			cp,
 			nil,
 			C.int(numSamples),
 			co,
-			C.int(estimatedSize),
+			C.int(len(mp3buf)),
 		))
 	} else {
 		n = int(C.lame_encode_buffer_interleaved(
@@ -299,58 +608,149 @@ func (e *Encoder) Write(p []byte) (int, error) {
 			cp,
 			C.int(numSamples),
 			co,
-			C.int(estimatedSize),
+			C.int(len(mp3buf)),
 		))
 	}
 
+	// the finalizer must not close the handle while lame is using it
+	runtime.KeepAlive(e)
 	if n < 0 {
-		err = convError(n)
-		return 0, err
+		return nil, convError(n)
 	}
-
-	o = o[:n]
-	if e.outremainder != nil {
-		o = append(e.outremainder, o...)
-	}
-
-	m, err := e.output.Write(o)
-	if m < len(o) {
-		e.outremainder = o[m : len(o)-m]
-	} else {
-		e.outremainder = nil
-	}
-	return inputDataSize, err
+	return mp3buf[:n], nil
 }
 
 // Flush flushes the encoder buffer
+//  n is the number of bytes lame produced on flush, all the encoded data
+//  pending is written to the underlying writer
 func (e *Encoder) Flush() (n int, err error) {
-	estimatedSize := 7200
-	o := make([]byte, estimatedSize)
-	co := (*C.uchar)(unsafe.Pointer(&o[0]))
-	bytesOut := C.int(C.lame_encode_flush(
-		e.lgf,
-		co,
-		C.int(estimatedSize),
-	))
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.flush()
+}
+
+func (e *Encoder) flush() (n int, err error) {
+	return e.flushStream(false)
+}
+
+// flushStream flushes lame buffers and writes the trailing tags
+//  nogap keeps the bit reservoir and doesn't pad the last frame
+//  so that the next stream continues the audio without a gap
+func (e *Encoder) flushStream(nogap bool) (n int, err error) {
+	if err = e.check(); err != nil {
+		return
+	}
+	if !e.started {
+		// nothing is encoded in the current stream
+		err = e.output.Flush()
+		return
+	}
+	mp3buf := e.mp3buffer()
+	co := (*C.uchar)(unsafe.Pointer(&mp3buf[0]))
+	var bytesOut C.int
+	if nogap {
+		bytesOut = C.lame_encode_flush_nogap(e.lgf, co, C.int(len(mp3buf)))
+	} else {
+		bytesOut = C.int(C.lame_encode_flush(
+			e.lgf,
+			co,
+			C.int(len(mp3buf)),
+		))
+	}
+	runtime.KeepAlive(e)
 	if bytesOut < 0 {
 		n = 0
-		err = convError(n)
+		err = convError(int(bytesOut))
 	} else if bytesOut != 0 {
-		n, err = e.output.Write(o[:bytesOut])
+		n, err = e.output.Write(mp3buf[:bytesOut])
 	} else {
 		n = 0
 	}
-	e.output.Flush()
+	if nogap && e.id3auto && !e.id3custom && err == nil {
+		// unlike lame_encode_flush the nogap one doesn't add the tag lame
+		// writes automatically
+		err = e.writeID3V1Tag()
+	}
+	if e.id3custom && err == nil {
+		// the stream is finished, APE tag and version 1 tag go last
+		if e.apeWrite {
+			err = e.writeAPETag()
+		}
+		if err == nil {
+			err = e.writeID3V1Tag()
+		}
+		e.id3custom = false
+	}
+	if ferr := e.output.Flush(); err == nil {
+		err = ferr
+	}
 	return
 }
 
-// Close closes the encoder if it's not closed yet
-// Note that encoder is being closed automatically on GC
-func (e *Encoder) Close() {
+// Close flushes and closes the encoder if it's not closed yet
+//  The error is the one Flush returns, the encoder is closed anyway.
+//  If the encoder's context is done, it's closed without flushing.
+//  Note that encoder is being closed automatically on GC
+func (e *Encoder) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	if e.closed {
-		return
+		return nil
 	}
-	e.Flush()
+	if err := e.check(); err != nil {
+		return err
+	}
+	_, err := e.flush()
 	C.lame_close(e.lgf)
+	e.releaseBuffers()
 	e.closed = true
+	return err
+}
+
+// Reset finishes the current stream and starts a new one written to w
+//  The current stream is flushed to the old writer. The new stream has the
+//  same parameters, lame_init_bitstream is called on the first Write so that
+//  tags, chapters and APE items dropped by Reset can be set for the new stream.
+//  Setting a parameter after Reset makes the encoder open a new lame handle
+//  dropping the tags set before, so parameters go first.
+//  Input data remaining from the previous Write is dropped.
+func (e *Encoder) Reset(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := e.flush(); err != nil {
+		return err
+	}
+	e.inremainderSize = 0
+	e.newStream(w)
+	return nil
+}
+
+// NextTrack finishes the current track and starts the next one written to w
+//  Unlike Reset the track is flushed with lame_encode_flush_nogap so the bit
+//  reservoir is kept and the tracks play back without a gap in between.
+//  The metadata of the finished track is dropped, the next track's tags are
+//  set from tags with ApplyTags unless it's nil. More tags can be set with
+//  the ID3TagSet* methods before the first Write of the track.
+func (e *Encoder) NextTrack(w io.Writer, tags interface{}) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := e.flushStream(true); err != nil {
+		return err
+	}
+	e.newStream(w)
+	if tags != nil {
+		return ApplyTags(e, tags)
+	}
+	return nil
+}
+
+// newStream switches the output to w and drops the metadata of the finished stream
+func (e *Encoder) newStream(w io.Writer) {
+	e.setWriter(w)
+	e.started = false
+	e.InitID3Tag()
+	e.chapters = nil
+	e.apeItems = nil
 }
@@ -1,10 +1,14 @@
 package lame
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
 	"reflect"
 	"runtime"
 	"testing"
+	"testing/iotest"
 )
 
 type counter struct {
@@ -92,3 +96,228 @@ func TestEncoder(t *testing.T) {
 		t.Error("encoder byte counter is greater than 1500 which is too high for the best compression and worst quality")
 	}
 }
+
+func pcmInput(size int) []byte {
+	input := make([]byte, size)
+	for i := range input {
+		input[i] = byte(i)
+	}
+	return input
+}
+
+func TestEncoderWriteAllocs(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	defer enc.Close()
+	input := pcmInput(4607)
+
+	// the first write initializes the encoder
+	enc.Write(input)
+	allocs := testing.AllocsPerRun(100, func() {
+		enc.Write(input)
+	})
+	if allocs != 0 {
+		t.Errorf("Write made %v allocations, expected none", allocs)
+	}
+}
+
+func TestEncoderWriteUnaligned(t *testing.T) {
+	aligned := new(counter)
+	enc := NewEncoder(aligned)
+	enc.Write(pcmInput(40000))
+	enc.Close()
+
+	unaligned := new(counter)
+	enc = NewEncoder(unaligned)
+	input := pcmInput(40000)
+	for len(input) > 0 {
+		n := 333
+		if n > len(input) {
+			n = len(input)
+		}
+		written, err := enc.Write(input[:n])
+		if err != nil || written != n {
+			t.Fatalf("Write returned %d, %v", written, err)
+		}
+		input = input[n:]
+	}
+	enc.Close()
+
+	if aligned.cnt != unaligned.cnt {
+		t.Errorf("unaligned writes produced %d bytes, expected %d", unaligned.cnt, aligned.cnt)
+	}
+}
+
+func benchmarkWrite(b *testing.B, channels int, size int) {
+	enc := NewEncoder(ioutil.Discard)
+	defer enc.Close()
+	enc.SetNumChannels(channels)
+	input := pcmInput(size)
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		enc.Write(input)
+	}
+}
+
+func BenchmarkWriteStereo(b *testing.B) {
+	benchmarkWrite(b, 2, 4608)
+}
+
+func BenchmarkWriteMono(b *testing.B) {
+	benchmarkWrite(b, 1, 4608)
+}
+
+func BenchmarkWriteUnaligned(b *testing.B) {
+	benchmarkWrite(b, 2, 4607)
+}
+
+func BenchmarkWriteLargeBlocks(b *testing.B) {
+	benchmarkWrite(b, 2, 1<<20)
+}
+
+func BenchmarkNewEncoder(b *testing.B) {
+	input := pcmInput(4608)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		enc := NewEncoder(ioutil.Discard)
+		enc.Write(input)
+		enc.Close()
+	}
+}
+
+func TestEncoderReadFrom(t *testing.T) {
+	input := pcmInput(100001)
+
+	written := new(bytes.Buffer)
+	enc := NewEncoder(written)
+	enc.Write(input)
+	enc.Close()
+
+	read := new(bytes.Buffer)
+	enc = NewEncoder(read)
+	// a sample split between Write and ReadFrom
+	enc.Write(input[:3])
+	n, err := enc.ReadFrom(iotest.HalfReader(bytes.NewReader(input[3:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(input)-3) {
+		t.Errorf("ReadFrom returned %d, expected %d", n, len(input)-3)
+	}
+	enc.Close()
+
+	if !bytes.Equal(read.Bytes(), written.Bytes()) {
+		t.Errorf("ReadFrom produced %d bytes, Write produced %d", read.Len(), written.Len())
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failure")
+}
+
+func TestEncoderReadFromError(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	defer enc.Close()
+	r := io.MultiReader(bytes.NewReader(pcmInput(1001)), failingReader{})
+	n, err := io.Copy(enc, r)
+	if err == nil || err.Error() != "read failure" {
+		t.Errorf("expected read failure, got %v", err)
+	}
+	if n != 1001 {
+		t.Errorf("%d bytes copied, expected 1001", n)
+	}
+}
+
+func BenchmarkReadFrom(b *testing.B) {
+	enc := NewEncoder(ioutil.Discard)
+	defer enc.Close()
+	input := pcmInput(1 << 20)
+	r := bytes.NewReader(input)
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(input)
+		io.Copy(enc, r)
+	}
+}
+
+func TestEncoderReset(t *testing.T) {
+	input := pcmInput(50001)
+
+	first, second, third := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	enc := NewEncoder(first)
+	enc.ID3TagSetPrivate("com.example", []byte("first"))
+	enc.Write(input)
+	if err := enc.Reset(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.AddChapter(Chapter{Title: "Second"}); err != nil {
+		t.Errorf("chapters can't be added after Reset: %v", err)
+	}
+	enc.Write(input)
+	if first.Len() == 0 {
+		t.Error("the first stream is not flushed on Reset")
+	}
+
+	// a parameter set after Reset is applied to the next stream
+	if err := enc.Reset(third); err != nil {
+		t.Fatal(err)
+	}
+	enc.SetNumChannels(1)
+	enc.Write(input)
+	enc.Close()
+
+	if bytes.Contains(second.Bytes(), []byte("first")) {
+		t.Error("frames of the first stream are kept after Reset")
+	}
+	if !bytes.Contains(second.Bytes(), []byte("CHAP")) {
+		t.Error("the chapter added after Reset is not written")
+	}
+	mono := new(bytes.Buffer)
+	enc = NewEncoder(mono)
+	enc.SetNumChannels(1)
+	enc.Write(input)
+	enc.Close()
+	if !bytes.Equal(third.Bytes(), mono.Bytes()) {
+		t.Errorf("the stream reconfigured after Reset has %d bytes, a fresh encoder produced %d", third.Len(), mono.Len())
+	}
+}
+
+func TestEncoderNextTrack(t *testing.T) {
+	type trackTags struct {
+		Title string `id3:"TIT2"`
+		Track int    `id3:"TRCK"`
+	}
+	input := pcmInput(30001)
+
+	first, second := new(bytes.Buffer), new(bytes.Buffer)
+	enc := NewEncoder(first)
+	enc.ID3TagSetTitle("First")
+	enc.Write(input)
+	if err := enc.NextTrack(second, trackTags{Title: "Second", Track: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if enc.id3fields.title != "Second" || enc.id3fields.track != "2" {
+		t.Errorf("tags of the next track are not applied: %+v", enc.id3fields)
+	}
+	if enc.inremainderSize != 1 {
+		t.Error("the trailing input is expected to be kept for the next track")
+	}
+	enc.Write(input)
+	enc.Close()
+
+	if first.Len() == 0 || second.Len() == 0 {
+		t.Errorf("both tracks are expected to have data, got %d and %d bytes", first.Len(), second.Len())
+	}
+	for i, track := range [][]byte{first.Bytes(), second.Bytes()} {
+		if len(track) < 128 || string(track[len(track)-128:len(track)-125]) != "TAG" {
+			t.Errorf("track %d doesn't end with ID3v1 tag", i+1)
+		}
+	}
+}
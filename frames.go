@@ -0,0 +1,56 @@
+package lame
+
+import (
+	"io"
+
+	"github.com/viert/go-lame/mp3"
+)
+
+// WithFrameHandler makes the encoder deliver every complete MP3 frame to handler
+//  Frames carry their index, header and PTS in samples shifted by the encoder
+//  delay. ID3 and APE tags are written to the writer only, which can be nil if
+//  the frames are all the caller needs. Output buffering is disabled so frames
+//  are delivered as soon as lame produces them, and the VBR tag frame is turned
+//  off as it can't be updated in a stream. Frame data is only valid until
+//  handler returns, an error returned by handler is returned by Write.
+func WithFrameHandler(handler func(mp3.Frame) error) Option {
+	return func(e *Encoder) {
+		e.frames = mp3.NewFrameWriter(handler)
+	}
+}
+
+// setWriter sets the writer the encoded data is written to
+func (e *Encoder) setWriter(w io.Writer) {
+	if e.frames != nil {
+		e.frames.Reset()
+		w = e.frameSink(w)
+	}
+	e.output.w = w
+}
+
+// frameSink returns a writer splitting the data into frames and
+// passing it through to w
+func (e *Encoder) frameSink(w io.Writer) io.Writer {
+	if w == nil {
+		return e.frames
+	}
+	return &frameTee{w: w, frames: e.frames}
+}
+
+// frameTee writes the data to w and passes the part w accepted to frames
+//  Short writes are retried before the frames get the data, so the frames
+//  see every byte exactly once even if the output retries the rest later.
+type frameTee struct {
+	w      io.Writer
+	frames *mp3.FrameWriter
+}
+
+func (t *frameTee) Write(p []byte) (int, error) {
+	n, err := writeFull(t.w, p)
+	if n > 0 {
+		if _, ferr := t.frames.Write(p[:n]); err == nil {
+			err = ferr
+		}
+	}
+	return n, err
+}
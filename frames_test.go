@@ -0,0 +1,69 @@
+package lame
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/viert/go-lame/mp3"
+)
+
+func TestFrameHandler(t *testing.T) {
+	var frames []mp3.Frame
+	var size int
+	out := new(bytes.Buffer)
+	enc := NewEncoder(out, WithFrameHandler(func(f mp3.Frame) error {
+		size += len(f.Data)
+		f.Data = nil
+		frames = append(frames, f)
+		return nil
+	}))
+	if enc.WriteVBRTag() {
+		t.Error("VBR tag is expected to be turned off")
+	}
+	enc.ID3TagSetPrivate("com.example", []byte("tagged"))
+	enc.Write(pcmInput(44100 * 4))
+	enc.Close()
+
+	if len(frames) == 0 {
+		t.Fatal("no frames delivered")
+	}
+	// the first frame starts before the input by the encoder delay
+	delay := -frames[0].PTS
+	if delay <= 0 {
+		t.Errorf("first frame PTS is %d, expected to be negative", frames[0].PTS)
+	}
+	for i, f := range frames {
+		samples := int64(f.Duration())
+		if f.Index != int64(i) || f.PTS != int64(i)*samples-delay {
+			t.Errorf("frame %d has index %d and PTS %d", i, f.Index, f.PTS)
+		}
+	}
+	if !bytes.HasPrefix(out.Bytes(), []byte("ID3")) {
+		t.Error("the tag is expected to be written to the writer")
+	}
+	if out.Len() <= size {
+		t.Errorf("writer got %d bytes, frames are %d bytes", out.Len(), size)
+	}
+}
+
+func TestFrameHandlerShortWrites(t *testing.T) {
+	encode := func(w io.Writer) (data []byte) {
+		enc := NewEncoder(w, WithFrameHandler(func(f mp3.Frame) error {
+			data = append(data, f.Data...)
+			return nil
+		}))
+		enc.Write(pcmInput(44100 * 4))
+		enc.Close()
+		return data
+	}
+
+	expected := encode(new(bytes.Buffer))
+	out := &choppyWriter{max: 100}
+	if data := encode(out); !bytes.Equal(data, expected) {
+		t.Errorf("frames of %d bytes delivered writing to a short writer, expected %d", len(data), len(expected))
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("writer got %d bytes, expected %d", out.Len(), len(expected))
+	}
+}
@@ -0,0 +1,49 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// m3u8 version 3 is the first one with fractional EXTINF durations
+const playlistVersion = 3
+
+// writePlaylist writes the playlist replacing the previous one
+//  Finished playlists get EXT-X-ENDLIST, a VOD one is an event playlist until then.
+func (s *Segmenter) writePlaylist(finished bool) error {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&buf, "#EXT-X-VERSION:%d\n", playlistVersion)
+	fmt.Fprintf(&buf, "#EXT-X-TARGETDURATION:%d\n", s.targetDuration)
+	fmt.Fprintf(&buf, "#EXT-X-MEDIA-SEQUENCE:%d\n", s.mediaSeq)
+	if s.discontinuitySeq > 0 {
+		fmt.Fprintf(&buf, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", s.discontinuitySeq)
+	}
+	if s.cfg.Type == VOD {
+		if finished {
+			buf.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+		} else {
+			buf.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
+		}
+	}
+
+	for _, seg := range s.segments {
+		if seg.discontinuity {
+			buf.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&buf, "#EXTINF:%.3f,\n%s\n", seg.duration.Seconds(), seg.name)
+	}
+	if finished {
+		buf.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	w, err := s.storage.Create(s.cfg.PlaylistName)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
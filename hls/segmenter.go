@@ -0,0 +1,288 @@
+// Package hls cuts an MP3 stream into HTTP Live Streaming segments
+//  Segments are MPEG audio elementary streams starting with the ID3 timestamp
+//  tag required for packed audio by RFC 8216. The segmenter consumes frames,
+//  so it's used with the encoder frame handler:
+//
+//    seg := hls.NewSegmenter(hls.DirStorage("/var/www/live"), hls.Config{})
+//    enc := lame.NewEncoder(nil, lame.WithFrameHandler(seg.WriteFrame))
+//    enc.SetDisableReservoir(true)
+//
+//  Frames may borrow bits from the previous ones through the bit reservoir,
+//  a segment starting with such a frame has a glitch at its beginning when
+//  played on its own, so the reservoir should be disabled.
+package hls
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/viert/go-lame/id3"
+	"github.com/viert/go-lame/mp3"
+)
+
+// PlaylistType is the kind of the playlist maintained
+type PlaylistType int
+
+// Playlist types
+const (
+	// Live keeps a sliding window of the latest segments
+	Live PlaylistType = iota
+	// VOD keeps all the segments, the playlist is an event one until Close
+	VOD
+)
+
+// Config defaults
+const (
+	DefaultTargetDuration = 6 * time.Second
+	DefaultWindowSize     = 5
+	DefaultSegmentName    = "segment%05d.mp3"
+	DefaultPlaylistName   = "playlist.m3u8"
+)
+
+// TimestampOwner is the owner of the ID3 PRIV frame holding the segment timestamp
+const TimestampOwner = "com.apple.streaming.transportStreamTimestamp"
+
+// timestamps are 33 bit MPEG-2 PTS values in 90kHz units
+const (
+	timestampRate = 90000
+	timestampMask = 1<<33 - 1
+)
+
+// ErrClosed is returned on writing to a closed segmenter
+var ErrClosed = errors.New("hls: segmenter is closed")
+
+// Config describes segments and the playlist, zero values mean defaults
+type Config struct {
+	Type PlaylistType
+	// TargetDuration is the maximum segment duration, segments are cut
+	// on frame boundaries so they're a bit shorter
+	TargetDuration time.Duration
+	// WindowSize is the number of segments in a live playlist,
+	// segments which left the window are removed after as many more segments
+	WindowSize int
+	// SegmentName is a format of segment names taking the sequence number
+	SegmentName  string
+	PlaylistName string
+}
+
+type segment struct {
+	name          string
+	duration      time.Duration
+	discontinuity bool
+}
+
+// Segmenter writes frames into segments and maintains the playlist
+//  Segmenter is not safe for concurrent use, WriteFrame is called by the
+//  encoder within its Write and Flush, so Discontinuity and Close must not
+//  be called concurrently with them.
+type Segmenter struct {
+	storage Storage
+	cfg     Config
+
+	// segments in the playlist and the ones which left it and not removed yet
+	segments []segment
+	expired  []segment
+	// sequence numbers of the first segment in the playlist and of the next one
+	mediaSeq         int64
+	nextSeq          int64
+	discontinuitySeq int64
+	targetDuration   int
+
+	cur           io.WriteCloser
+	curName       string
+	curSamples    int64
+	curSamplerate int
+	discontinuity bool
+	lastIndex     int64
+	closed        bool
+}
+
+// NewSegmenter creates a segmenter writing to storage
+func NewSegmenter(storage Storage, cfg Config) *Segmenter {
+	if cfg.TargetDuration <= 0 {
+		cfg.TargetDuration = DefaultTargetDuration
+	}
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = DefaultWindowSize
+	}
+	if cfg.SegmentName == "" {
+		cfg.SegmentName = DefaultSegmentName
+	}
+	if cfg.PlaylistName == "" {
+		cfg.PlaylistName = DefaultPlaylistName
+	}
+	return &Segmenter{
+		storage:        storage,
+		cfg:            cfg,
+		targetDuration: ceilSeconds(cfg.TargetDuration),
+		lastIndex:      -1,
+	}
+}
+
+// WriteFrame adds a frame to the current segment
+//  The segment is finished and the playlist is updated when the frame doesn't
+//  fit into the target duration. A frame index going back, e.g. after the
+//  encoder is reset or switched to the next track, and a samplerate change
+//  start a new segment marked as a discontinuity.
+func (s *Segmenter) WriteFrame(f mp3.Frame) error {
+	if s.closed {
+		return ErrClosed
+	}
+	if s.lastIndex >= 0 && f.Index <= s.lastIndex ||
+		s.cur != nil && f.Header.Samplerate != s.curSamplerate {
+		if err := s.Discontinuity(); err != nil {
+			return err
+		}
+	}
+	s.lastIndex = f.Index
+
+	samples := int64(f.Duration())
+	if s.cur != nil && samplesDuration(s.curSamples+samples, s.curSamplerate) > s.cfg.TargetDuration {
+		if err := s.finishSegment(); err != nil {
+			return err
+		}
+	}
+	if s.cur == nil {
+		if err := s.startSegment(f); err != nil {
+			return err
+		}
+	}
+	if _, err := s.cur.Write(f.Data); err != nil {
+		return err
+	}
+	s.curSamples += samples
+	return nil
+}
+
+// Discontinuity finishes the current segment and marks the next one
+//  as a discontinuity, e.g. when encoding parameters change.
+func (s *Segmenter) Discontinuity() error {
+	if s.closed {
+		return ErrClosed
+	}
+	if s.cur != nil {
+		if err := s.finishSegment(); err != nil {
+			return err
+		}
+	}
+	if s.nextSeq > 0 {
+		s.discontinuity = true
+	}
+	return nil
+}
+
+// Close finishes the current segment and ends the playlist
+//  A VOD playlist becomes one with all the segments,
+//  a live one tells the clients the stream is over.
+func (s *Segmenter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.cur != nil {
+		if err := s.closeSegment(); err != nil {
+			return err
+		}
+	}
+	return s.writePlaylist(true)
+}
+
+func (s *Segmenter) startSegment(f mp3.Frame) error {
+	name := fmt.Sprintf(s.cfg.SegmentName, s.nextSeq)
+	w, err := s.storage.Create(name)
+	if err != nil {
+		return err
+	}
+	tag, err := timestampTag(f.PTS, f.Header.Samplerate)
+	if err == nil {
+		_, err = w.Write(tag)
+	}
+	if err != nil {
+		w.Close()
+		return err
+	}
+	s.cur = w
+	s.curName = name
+	s.curSamples = 0
+	s.curSamplerate = f.Header.Samplerate
+	return nil
+}
+
+// finishSegment closes the current segment and updates the playlist
+func (s *Segmenter) finishSegment() error {
+	if err := s.closeSegment(); err != nil {
+		return err
+	}
+	return s.writePlaylist(false)
+}
+
+// closeSegment closes the current segment and adds it to the playlist
+//  The oldest segment of a live playlist leaves it if the window is full.
+func (s *Segmenter) closeSegment() error {
+	w := s.cur
+	s.cur = nil
+	if err := w.Close(); err != nil {
+		return err
+	}
+	seg := segment{
+		name:          s.curName,
+		duration:      samplesDuration(s.curSamples, s.curSamplerate),
+		discontinuity: s.discontinuity,
+	}
+	s.segments = append(s.segments, seg)
+	s.nextSeq++
+	s.discontinuity = false
+	// EXTINF rounded to the nearest integer must not exceed the target duration
+	if d := int((seg.duration + time.Second/2) / time.Second); d > s.targetDuration {
+		s.targetDuration = d
+	}
+	if s.cfg.Type == Live && len(s.segments) > s.cfg.WindowSize {
+		return s.slideWindow()
+	}
+	return nil
+}
+
+// slideWindow moves the oldest segment out of the playlist
+//  and removes the segments which left it long ago
+func (s *Segmenter) slideWindow() error {
+	seg := s.segments[0]
+	s.segments[0] = segment{}
+	s.segments = s.segments[1:]
+	s.mediaSeq++
+	if seg.discontinuity {
+		s.discontinuitySeq++
+	}
+	s.expired = append(s.expired, seg)
+
+	for len(s.expired) > s.cfg.WindowSize {
+		if err := s.storage.Remove(s.expired[0].name); err != nil {
+			return err
+		}
+		s.expired[0] = segment{}
+		s.expired = s.expired[1:]
+	}
+	return nil
+}
+
+// timestampTag returns the ID3 tag with the segment start timestamp
+func timestampTag(pts int64, samplerate int) ([]byte, error) {
+	ts := make([]byte, 8)
+	// negative timestamps of the encoder delay wrap around like MPEG-2 PTS do
+	binary.BigEndian.PutUint64(ts, uint64(pts*timestampRate/int64(samplerate))&timestampMask)
+	tag := &id3.V2{
+		Version: 4,
+		Frames:  []id3.Frame{&id3.PrivateFrame{Owner: TimestampOwner, Data: ts}},
+	}
+	return tag.Bytes()
+}
+
+func samplesDuration(samples int64, samplerate int) time.Duration {
+	return time.Duration(samples * int64(time.Second) / int64(samplerate))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
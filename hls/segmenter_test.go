@@ -0,0 +1,201 @@
+package hls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/viert/go-lame/id3"
+	"github.com/viert/go-lame/internal/mp3test"
+	"github.com/viert/go-lame/mp3"
+)
+
+// memStorage keeps files in memory
+type memStorage map[string][]byte
+
+type memFile struct {
+	bytes.Buffer
+	storage memStorage
+	name    string
+}
+
+func (f *memFile) Close() error {
+	f.storage[f.name] = f.Bytes()
+	return nil
+}
+
+func (m memStorage) Create(name string) (io.WriteCloser, error) {
+	return &memFile{storage: m, name: name}, nil
+}
+
+func (m memStorage) Remove(name string) error {
+	delete(m, name)
+	return nil
+}
+
+func writeFrames(t *testing.T, s *Segmenter, frames []mp3.Frame) {
+	for _, f := range frames {
+		if err := s.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func segmentTimestamp(t *testing.T, data []byte) uint64 {
+	tag, err := id3.ReadV2(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, ok := tag.Private(TimestampOwner)
+	if !ok || len(ts) != 8 {
+		t.Fatalf("no timestamp in the segment tag")
+	}
+	return binary.BigEndian.Uint64(ts)
+}
+
+func TestSegmenterVOD(t *testing.T) {
+	storage := make(memStorage)
+	s := NewSegmenter(storage, Config{Type: VOD, TargetDuration: time.Second})
+	writeFrames(t, s, mp3test.Frames(100))
+
+	playlist := string(storage[DefaultPlaylistName])
+	if !strings.Contains(playlist, "#EXT-X-PLAYLIST-TYPE:EVENT\n") {
+		t.Errorf("unfinished VOD playlist is expected to be an event one:\n%s", playlist)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteFrame(mp3test.Frames(1)[0]); err != ErrClosed {
+		t.Errorf("expected ErrClosed writing to a closed segmenter, got %v", err)
+	}
+
+	expected := "#EXTM3U\n" +
+		"#EXT-X-VERSION:3\n" +
+		"#EXT-X-TARGETDURATION:1\n" +
+		"#EXT-X-MEDIA-SEQUENCE:0\n" +
+		"#EXT-X-PLAYLIST-TYPE:VOD\n" +
+		"#EXTINF:0.993,\nsegment00000.mp3\n" +
+		"#EXTINF:0.993,\nsegment00001.mp3\n" +
+		"#EXTINF:0.627,\nsegment00002.mp3\n" +
+		"#EXT-X-ENDLIST\n"
+	if playlist := string(storage[DefaultPlaylistName]); playlist != expected {
+		t.Errorf("playlist is\n%s\nexpected\n%s", playlist, expected)
+	}
+
+	for i, n := range []int{38, 38, 24} {
+		data := storage[fmt.Sprintf(DefaultSegmentName, i)]
+		ts := segmentTimestamp(t, data)
+		pts := int64(i*38*1152 - mp3test.Delay)
+		if expected := uint64(pts*90000/44100) & timestampMask; ts != expected {
+			t.Errorf("segment %d timestamp is %d, expected %d", i, ts, expected)
+		}
+		tagSize := len(data) - n*mp3test.FrameSize
+		if tagSize <= 0 || data[tagSize] != 0xff {
+			t.Errorf("segment %d is expected to have %d frames after the tag", i, n)
+		}
+	}
+}
+
+func TestSegmenterLive(t *testing.T) {
+	storage := make(memStorage)
+	s := NewSegmenter(storage, Config{TargetDuration: time.Second, WindowSize: 2})
+	// 5 full segments and a partial one
+	writeFrames(t, s, mp3test.Frames(200))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	playlist := string(storage[DefaultPlaylistName])
+	for _, line := range []string{
+		"#EXT-X-MEDIA-SEQUENCE:4\n",
+		"segment00004.mp3\n",
+		"segment00005.mp3\n",
+		"#EXT-X-ENDLIST\n",
+	} {
+		if !strings.Contains(playlist, line) {
+			t.Errorf("playlist doesn't contain %q:\n%s", line, playlist)
+		}
+	}
+	if strings.Contains(playlist, "segment00003.mp3") || strings.Contains(playlist, "PLAYLIST-TYPE") {
+		t.Errorf("unexpected live playlist:\n%s", playlist)
+	}
+	// segments which left the window are kept for another window
+	for i := 0; i < 6; i++ {
+		_, found := storage[fmt.Sprintf(DefaultSegmentName, i)]
+		if found != (i >= 2) {
+			t.Errorf("segment %d presence is %v", i, found)
+		}
+	}
+}
+
+func TestSegmenterDiscontinuity(t *testing.T) {
+	storage := make(memStorage)
+	s := NewSegmenter(storage, Config{TargetDuration: time.Second, WindowSize: 2})
+	writeFrames(t, s, mp3test.Frames(10))
+	// the next track starts over
+	writeFrames(t, s, mp3test.Frames(10))
+	if err := s.Discontinuity(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Discontinuity(); err != nil {
+		t.Fatal(err)
+	}
+	writeFrames(t, s, mp3test.Frames(50)[10:])
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second segment with the discontinuity has left the window
+	playlist := string(storage[DefaultPlaylistName])
+	expected := "#EXTM3U\n" +
+		"#EXT-X-VERSION:3\n" +
+		"#EXT-X-TARGETDURATION:1\n" +
+		"#EXT-X-MEDIA-SEQUENCE:2\n" +
+		"#EXT-X-DISCONTINUITY-SEQUENCE:1\n" +
+		"#EXT-X-DISCONTINUITY\n" +
+		"#EXTINF:0.993,\nsegment00002.mp3\n" +
+		"#EXTINF:0.052,\nsegment00003.mp3\n" +
+		"#EXT-X-ENDLIST\n"
+	if playlist != expected {
+		t.Errorf("playlist is\n%s\nexpected\n%s", playlist, expected)
+	}
+}
+
+func TestDirStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewSegmenter(DirStorage(dir), Config{Type: VOD, TargetDuration: time.Second})
+	writeFrames(t, s, mp3test.Frames(40))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("expected a playlist and 2 segments, got %v", files)
+	}
+	playlist, err := ioutil.ReadFile(filepath.Join(dir, DefaultPlaylistName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(playlist, []byte("segment00001.mp3\n#EXT-X-ENDLIST\n")) {
+		t.Errorf("unexpected playlist:\n%s", playlist)
+	}
+	if err := DirStorage(dir).Remove("missing"); err != nil {
+		t.Errorf("removing a missing file returned %v", err)
+	}
+}
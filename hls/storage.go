@@ -0,0 +1,56 @@
+package hls
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Storage keeps segments and playlists
+type Storage interface {
+	// Create creates or replaces a file, readers must not see it
+	// before the writer is closed
+	Create(name string) (io.WriteCloser, error)
+	// Remove removes a file
+	Remove(name string) error
+}
+
+// DirStorage stores files in a local directory
+type DirStorage string
+
+// Create creates a temporary file which is renamed to name on Close
+func (d DirStorage) Create(name string) (io.WriteCloser, error) {
+	f, err := ioutil.TempFile(string(d), "."+name+".")
+	if err != nil {
+		return nil, err
+	}
+	return &dirFile{File: f, path: filepath.Join(string(d), name)}, nil
+}
+
+// Remove removes a file, missing files are ignored
+func (d DirStorage) Remove(name string) error {
+	err := os.Remove(filepath.Join(string(d), name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+type dirFile struct {
+	*os.File
+	path string
+}
+
+func (f *dirFile) Close() error {
+	if err := f.File.Chmod(0644); err != nil {
+		f.File.Close()
+		os.Remove(f.File.Name())
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	return os.Rename(f.File.Name(), f.path)
+}
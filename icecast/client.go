@@ -0,0 +1,433 @@
+// Package icecast implements an Icecast and SHOUTcast v1 source client
+//  The client is an io.Writer taking an MP3 stream, so it's used as the encoder
+//  output. Tags are dropped, frames are sent in real time, the server is
+//  reconnected with a backoff if the connection breaks.
+//
+//    client := icecast.NewClient(icecast.Config{
+//        URL:      "http://localhost:8000/live.mp3",
+//        Password: "hackme",
+//    })
+//    defer client.Close()
+//    enc := lame.NewEncoder(client)
+package icecast
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viert/go-lame/mp3"
+)
+
+// Protocol is a source protocol
+type Protocol int
+
+// Source protocols
+const (
+	// HTTPPut is the HTTP PUT protocol of Icecast 2.4 and later
+	HTTPPut Protocol = iota
+	// Source is the legacy SOURCE method of Icecast
+	Source
+	// Shoutcast is the SHOUTcast v1 protocol, the source connects to the port
+	// next to the listeners one and sends the password line followed by icy headers
+	Shoutcast
+)
+
+// Config defaults
+const (
+	DefaultUser       = "source"
+	DefaultUserAgent  = "go-lame"
+	DefaultTimeout    = 10 * time.Second
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+var (
+	// ErrClosed is returned on writing to a closed client
+	ErrClosed = errors.New("icecast: client is closed")
+	// ErrAuth is returned if the server rejects the credentials,
+	// the client doesn't reconnect in this case
+	ErrAuth = errors.New("icecast: authentication failed")
+)
+
+// Config describes the server and the stream
+type Config struct {
+	// URL is the mount point, e.g. http://localhost:8000/live.mp3,
+	// the path is ignored by SHOUTcast
+	URL      string
+	Protocol Protocol
+	User     string
+	Password string
+	// AdminUser and AdminPassword are used to update metadata, the source
+	// credentials are used if not set
+	AdminUser     string
+	AdminPassword string
+
+	Name        string
+	Description string
+	Genre       string
+	StreamURL   string
+	Public      bool
+
+	// Bitrate in kbps, Samplerate and Channels are announced to the server,
+	// the values of the first frame are used if not set
+	Bitrate    int
+	Samplerate int
+	Channels   int
+
+	// Burst is the amount of audio sent ahead of real time on connecting
+	Burst time.Duration
+	// Timeout limits dialing, the handshake and every write
+	Timeout time.Duration
+	// MinBackoff is the delay before the first reconnect, it's doubled after
+	// every failed attempt up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxRetries is the number of failed reconnects after which the error is
+	// returned from Write, 0 means retrying until the client is closed
+	MaxRetries int
+
+	UserAgent string
+	// HTTPClient is used for metadata updates, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// Client streams MP3 frames to the server
+//  Write and Close may be called from different goroutines,
+//  UpdateMetadata is independent of streaming.
+type Client struct {
+	cfg    Config
+	frames *mp3.FrameWriter
+
+	mu   sync.Mutex
+	conn net.Conn
+	// start is the time the first frame after connecting was sent,
+	// sent is the duration of the audio sent since then
+	start time.Time
+	sent  time.Duration
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewClient creates a client, the server is connected on the first frame
+func NewClient(cfg Config) *Client {
+	if cfg.User == "" {
+		cfg.User = DefaultUser
+	}
+	if cfg.AdminUser == "" {
+		cfg.AdminUser = cfg.User
+	}
+	if cfg.AdminPassword == "" {
+		cfg.AdminPassword = cfg.Password
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = DefaultMaxBackoff
+		if cfg.MaxBackoff < cfg.MinBackoff {
+			cfg.MaxBackoff = cfg.MinBackoff
+		}
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	c := &Client{cfg: cfg, done: make(chan struct{})}
+	c.frames = mp3.NewFrameWriter(c.WriteFrame)
+	return c
+}
+
+// Write splits p into frames and sends them, tags and junk are dropped
+func (c *Client) Write(p []byte) (int, error) {
+	return c.frames.Write(p)
+}
+
+// WriteFrame sends a frame waiting for its time
+//  If the connection breaks the server is reconnected and the frame is sent again.
+func (c *Client) WriteFrame(f mp3.Frame) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		var err error
+		if conn, err = c.reconnect(f.Header); err != nil {
+			return err
+		}
+	}
+
+	if !c.wait(c.start.Add(c.sent - c.cfg.Burst)) {
+		return ErrClosed
+	}
+	for {
+		conn.SetWriteDeadline(time.Now().Add(c.cfg.Timeout))
+		_, err := conn.Write(f.Data)
+		if err == nil {
+			break
+		}
+		if c.isClosed() {
+			return ErrClosed
+		}
+		c.dropConn(conn)
+		if conn, err = c.reconnect(f.Header); err != nil {
+			return err
+		}
+	}
+	c.sent += time.Duration(int64(f.Duration()) * int64(time.Second) / int64(f.Header.Samplerate))
+	return nil
+}
+
+// Close closes the connection, a pending reconnect is interrupted
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait sleeps until t returning false if the client is closed meanwhile
+func (c *Client) wait(t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return !c.isClosed()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *Client) dropConn(conn net.Conn) {
+	conn.Close()
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+}
+
+// reconnect connects the server retrying with a backoff
+//  The first attempt is made at once, ErrAuth stops retrying.
+func (c *Client) reconnect(h mp3.Header) (net.Conn, error) {
+	backoff := c.cfg.MinBackoff
+	for attempt := 0; ; attempt++ {
+		conn, err := c.connect(h)
+		if err == nil {
+			c.mu.Lock()
+			if c.isClosed() {
+				c.mu.Unlock()
+				conn.Close()
+				return nil, ErrClosed
+			}
+			c.conn = conn
+			c.mu.Unlock()
+			c.start = time.Now()
+			c.sent = 0
+			return conn, nil
+		}
+		if err == ErrAuth || c.cfg.MaxRetries > 0 && attempt >= c.cfg.MaxRetries {
+			return nil, err
+		}
+		if !c.wait(time.Now().Add(backoff)) {
+			return nil, ErrClosed
+		}
+		backoff *= 2
+		if backoff > c.cfg.MaxBackoff {
+			backoff = c.cfg.MaxBackoff
+		}
+	}
+}
+
+// connect dials the server and makes the protocol handshake
+func (c *Client) connect(h mp3.Header) (net.Conn, error) {
+	u, err := url.Parse(c.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "80")
+	}
+	if c.cfg.Protocol == Shoutcast {
+		if addr, err = shoutcastSourceAddr(addr); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, c.cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(c.cfg.Timeout))
+	if c.cfg.Protocol == Shoutcast {
+		err = c.shoutcastHandshake(conn, h)
+	} else {
+		err = c.icecastHandshake(conn, u, h)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (c *Client) icecastHandshake(conn net.Conn, u *url.URL, h mp3.Header) error {
+	method, proto := "PUT", "HTTP/1.1"
+	if c.cfg.Protocol == Source {
+		method, proto = "SOURCE", "HTTP/1.0"
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s\r\n", method, path, proto)
+	fmt.Fprintf(&b, "Host: %s\r\n", u.Host)
+	fmt.Fprintf(&b, "Authorization: %s\r\n", basicAuth(c.cfg.User, c.cfg.Password))
+	fmt.Fprintf(&b, "User-Agent: %s\r\n", c.cfg.UserAgent)
+	b.WriteString("Content-Type: audio/mpeg\r\n")
+	if c.cfg.Protocol == HTTPPut {
+		b.WriteString("Expect: 100-continue\r\n")
+	}
+	for _, header := range c.iceHeaders("ice-", h) {
+		b.WriteString(header)
+	}
+	b.WriteString("\r\n")
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusContinue, http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	}
+	return fmt.Errorf("icecast: server responded %s", resp.Status)
+}
+
+func (c *Client) shoutcastHandshake(conn net.Conn, h mp3.Header) error {
+	if _, err := io.WriteString(conn, c.cfg.Password+"\r\n"); err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK") {
+		return ErrAuth
+	}
+
+	var b strings.Builder
+	b.WriteString("content-type: audio/mpeg\r\n")
+	for _, header := range c.iceHeaders("icy-", h) {
+		b.WriteString(header)
+	}
+	b.WriteString("\r\n")
+	_, err = io.WriteString(conn, b.String())
+	return err
+}
+
+// iceHeaders returns the stream description headers with the prefix
+//  ice- for Icecast and icy- for SHOUTcast
+func (c *Client) iceHeaders(prefix string, h mp3.Header) []string {
+	bitrate, samplerate, channels := c.cfg.Bitrate, c.cfg.Samplerate, c.cfg.Channels
+	if bitrate == 0 {
+		bitrate = h.Bitrate
+	}
+	if samplerate == 0 {
+		samplerate = h.Samplerate
+	}
+	if channels == 0 {
+		channels = h.Channels()
+	}
+	public := "0"
+	if c.cfg.Public {
+		public = "1"
+	}
+
+	var headers []string
+	add := func(name, value string) {
+		if value != "" {
+			headers = append(headers, prefix+name+": "+value+"\r\n")
+		}
+	}
+	add("name", c.cfg.Name)
+	add("genre", c.cfg.Genre)
+	add("url", c.cfg.StreamURL)
+	if prefix == "icy-" {
+		add("pub", public)
+		add("br", strconv.Itoa(bitrate))
+		return headers
+	}
+	add("description", c.cfg.Description)
+	add("public", public)
+	add("bitrate", strconv.Itoa(bitrate))
+	add("audio-info", fmt.Sprintf("ice-samplerate=%d;ice-bitrate=%d;ice-channels=%d",
+		samplerate, bitrate, channels))
+	return headers
+}
+
+// shoutcastSourceAddr returns the source address of a SHOUTcast v1 server,
+// its port is the listeners one plus one
+func shoutcastSourceAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(n+1)), nil
+}
+
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
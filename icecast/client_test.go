@@ -0,0 +1,268 @@
+package icecast
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/viert/go-lame/internal/mp3test"
+)
+
+type source struct {
+	req  *http.Request
+	data []byte
+}
+
+// icecastServer accepts sources with the hackme password, a connection
+// is dropped after limit bytes of the stream if limit is positive
+func icecastServer(t *testing.T, limit int) (*httptest.Server, chan source) {
+	sources := make(chan source, 64)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, password, _ := req.BasicAuth(); user != DefaultUser || password != "hackme" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\n")
+
+		var r io.Reader = rw
+		if limit > 0 {
+			r = io.LimitReader(r, int64(limit))
+		}
+		data, _ := ioutil.ReadAll(r)
+		sources <- source{req: req, data: data}
+	}))
+	return srv, sources
+}
+
+func TestClientPut(t *testing.T) {
+	srv, sources := icecastServer(t, 0)
+	defer srv.Close()
+
+	client := NewClient(Config{
+		URL:      srv.URL + "/live.mp3",
+		Password: "hackme",
+		Name:     "Test",
+		Burst:    time.Second,
+	})
+	data, audio := mp3test.Stream(10)
+	if _, err := client.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if _, err := client.Write(data); err != ErrClosed {
+		t.Errorf("expected ErrClosed writing to a closed client, got %v", err)
+	}
+
+	src := <-sources
+	if src.req.Method != "PUT" || src.req.URL.Path != "/live.mp3" {
+		t.Errorf("unexpected request %s %s", src.req.Method, src.req.URL)
+	}
+	headers := map[string]string{
+		"Content-Type":   "audio/mpeg",
+		"Ice-Name":       "Test",
+		"Ice-Public":     "0",
+		"Ice-Bitrate":    "128",
+		"Ice-Audio-Info": "ice-samplerate=44100;ice-bitrate=128;ice-channels=2",
+	}
+	for name, value := range headers {
+		if got := src.req.Header.Get(name); got != value {
+			t.Errorf("%s header is %q, expected %q", name, got, value)
+		}
+	}
+	if !bytes.Equal(src.data, audio) {
+		t.Errorf("server got %d bytes, expected %d bytes of frames", len(src.data), len(audio))
+	}
+}
+
+func TestClientSource(t *testing.T) {
+	srv, sources := icecastServer(t, 0)
+	defer srv.Close()
+
+	client := NewClient(Config{
+		URL:      srv.URL + "/live.mp3",
+		Protocol: Source,
+		Password: "hackme",
+		Bitrate:  320,
+		Burst:    time.Second,
+	})
+	data, _ := mp3test.Stream(2)
+	client.Write(data)
+	client.Close()
+
+	src := <-sources
+	if src.req.Method != "SOURCE" || src.req.Header.Get("Ice-Bitrate") != "320" {
+		t.Errorf("unexpected request %s with bitrate %s", src.req.Method, src.req.Header.Get("Ice-Bitrate"))
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	srv, _ := icecastServer(t, 0)
+	defer srv.Close()
+
+	client := NewClient(Config{URL: srv.URL + "/live.mp3", Password: "wrong"})
+	defer client.Close()
+	data, _ := mp3test.Stream(1)
+	if _, err := client.Write(data); err != ErrAuth {
+		t.Errorf("expected ErrAuth, got %v", err)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	srv, sources := icecastServer(t, mp3test.FrameSize)
+	defer srv.Close()
+
+	client := NewClient(Config{
+		URL:        srv.URL + "/live.mp3",
+		Password:   "hackme",
+		Burst:      50 * time.Millisecond,
+		MinBackoff: time.Millisecond,
+	})
+	data, audio := mp3test.Stream(20)
+	if _, err := client.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	first, second := <-sources, <-sources
+	if !bytes.Equal(first.data, audio[:mp3test.FrameSize]) {
+		t.Error("the first connection is expected to get the first frame")
+	}
+	if len(second.data) != mp3test.FrameSize || !bytes.Contains(audio, second.data) {
+		t.Error("the server is expected to be reconnected")
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := NewClient(Config{URL: srv.URL, MinBackoff: time.Millisecond, MaxRetries: 2})
+	defer client.Close()
+	data, _ := mp3test.Stream(1)
+	if _, err := client.Write(data); err == nil || err == ErrAuth {
+		t.Errorf("expected the server error, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 connection attempts, got %d", attempts)
+	}
+}
+
+func TestClientPacing(t *testing.T) {
+	srv, _ := icecastServer(t, 0)
+	defer srv.Close()
+
+	client := NewClient(Config{URL: srv.URL, Password: "hackme"})
+	defer client.Close()
+	data, _ := mp3test.Stream(8)
+	start := time.Now()
+	client.Write(data)
+	// the last frame is sent after 7 frames of 1152 samples played
+	if elapsed, expected := time.Since(start), 7*1152*time.Second/44100; elapsed < expected {
+		t.Errorf("8 frames sent in %s, expected at least %s", elapsed, expected)
+	}
+}
+
+func TestClientShoutcast(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		password, _ := r.ReadString('\n')
+		io.WriteString(conn, "OK2\r\nicy-caps:11\r\n\r\n")
+		lines := []string{password}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+			lines = append(lines, line)
+		}
+		data, _ := ioutil.ReadAll(r)
+		received <- append(lines, string(data))
+	}()
+
+	// the source port is the listeners one plus one
+	port := ln.Addr().(*net.TCPAddr).Port
+	client := NewClient(Config{
+		URL:      "http://127.0.0.1:" + strconv.Itoa(port-1),
+		Protocol: Shoutcast,
+		Password: "hackme",
+		Genre:    "Jazz",
+		Burst:    time.Second,
+	})
+	data, audio := mp3test.Stream(3)
+	if _, err := client.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	lines := <-received
+	headers := strings.Join(lines[:len(lines)-1], "")
+	for _, header := range []string{"hackme\r\n", "icy-genre: Jazz\r\n", "icy-br: 128\r\n", "icy-pub: 0\r\n"} {
+		if !strings.Contains(headers, header) {
+			t.Errorf("%q not sent in\n%s", header, headers)
+		}
+	}
+	if lines[len(lines)-1] != string(audio) {
+		t.Error("unexpected stream data")
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+	}))
+	defer srv.Close()
+
+	client := NewClient(Config{URL: srv.URL + "/live.mp3", Password: "hackme"})
+	if err := client.UpdateMetadata(context.Background(), "Artist - Title"); err != nil {
+		t.Fatal(err)
+	}
+	query := got.URL.Query()
+	user, password, _ := got.BasicAuth()
+	if got.URL.Path != "/admin/metadata" || query.Get("mount") != "/live.mp3" ||
+		query.Get("mode") != "updinfo" || query.Get("song") != "Artist - Title" ||
+		user != DefaultUser || password != "hackme" {
+		t.Errorf("unexpected metadata request %s", got.URL)
+	}
+
+	client = NewClient(Config{URL: srv.URL, Protocol: Shoutcast, Password: "hackme"})
+	if err := client.UpdateMetadata(context.Background(), "Title"); err != nil {
+		t.Fatal(err)
+	}
+	query = got.URL.Query()
+	if got.URL.Path != "/admin.cgi" || query.Get("pass") != "hackme" || query.Get("song") != "Title" {
+		t.Errorf("unexpected metadata request %s", got.URL)
+	}
+}
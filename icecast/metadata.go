@@ -0,0 +1,56 @@
+package icecast
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// UpdateMetadata sets the now playing title via the server admin endpoint
+//  Icecast gets /admin/metadata of the mount, SHOUTcast v1 gets /admin.cgi
+//  on the listeners port.
+func (c *Client) UpdateMetadata(ctx context.Context, song string) error {
+	u, err := url.Parse(c.cfg.URL)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("mode", "updinfo")
+	query.Set("song", song)
+	if c.cfg.Protocol == Shoutcast {
+		u.Path = "/admin.cgi"
+		query.Set("pass", c.cfg.AdminPassword)
+	} else {
+		query.Set("mount", u.Path)
+		u.Path = "/admin/metadata"
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if c.cfg.Protocol == Shoutcast {
+		// SHOUTcast v1 only talks to browsers on the admin pages
+		req.Header.Set("User-Agent", "Mozilla/5.0 ("+c.cfg.UserAgent+")")
+	} else {
+		req.Header.Set("User-Agent", c.cfg.UserAgent)
+		req.SetBasicAuth(c.cfg.AdminUser, c.cfg.AdminPassword)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	}
+	return fmt.Errorf("icecast: metadata update responded %s", resp.Status)
+}
@@ -0,0 +1,206 @@
+package icy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/viert/go-lame/mp3"
+)
+
+// DefaultBufferSize is the number of frames queued for a listener by default,
+// about 6.7 seconds of 44100Hz audio
+const DefaultBufferSize = 256
+
+// ErrClosed is returned on writing to a closed broadcaster
+var ErrClosed = errors.New("icy: broadcaster is closed")
+
+// Config describes the stream served
+type Config struct {
+	// MetaInt is the number of audio bytes between metadata blocks
+	MetaInt int
+	// BufferSize is the number of frames queued for a listener,
+	// the listeners which fall behind more are dropped
+	BufferSize int
+	// Name, Genre, URL and Bitrate in kbps are sent in icy- headers if set
+	Name    string
+	Genre   string
+	URL     string
+	Bitrate int
+}
+
+type listener struct {
+	frames chan []byte
+}
+
+// Broadcaster fans an MP3 stream out to many HTTP listeners
+//  It's an io.Writer taking the encoder output, the stream is split into
+//  frames so listeners start at a frame boundary, tags are dropped.
+//  Every frame is copied once and shared by the listeners. Writes never
+//  block, a listener whose buffer is full is disconnected.
+type Broadcaster struct {
+	cfg    Config
+	title  Title
+	frames *mp3.FrameWriter
+
+	mu        sync.Mutex
+	listeners map[*listener]struct{}
+	closed    bool
+}
+
+// NewBroadcaster creates a broadcaster
+func NewBroadcaster(cfg Config) *Broadcaster {
+	if cfg.MetaInt <= 0 {
+		cfg.MetaInt = DefaultMetaInt
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultBufferSize
+	}
+	b := &Broadcaster{cfg: cfg, listeners: make(map[*listener]struct{})}
+	b.frames = mp3.NewFrameWriter(b.WriteFrame)
+	return b
+}
+
+// SetTitle changes the stream title, it may be called concurrently with Write
+func (b *Broadcaster) SetTitle(title string) {
+	b.title.Set(title)
+}
+
+// Title returns the stream title
+func (b *Broadcaster) Title() string {
+	return b.title.Get()
+}
+
+// Write splits p into frames and queues them for the listeners
+func (b *Broadcaster) Write(p []byte) (int, error) {
+	return b.frames.Write(p)
+}
+
+// WriteFrame queues a frame for the listeners dropping the slow ones
+func (b *Broadcaster) WriteFrame(f mp3.Frame) error {
+	data := make([]byte, len(f.Data))
+	copy(data, f.Data)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	for l := range b.listeners {
+		select {
+		case l.frames <- data:
+		default:
+			b.remove(l)
+		}
+	}
+	return nil
+}
+
+// Listeners returns the number of listeners connected
+func (b *Broadcaster) Listeners() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.listeners)
+}
+
+// Close disconnects the listeners, new ones are refused
+func (b *Broadcaster) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for l := range b.listeners {
+		b.remove(l)
+	}
+	return nil
+}
+
+// ServeHTTP streams to a listener until it disconnects or falls behind
+//  Metadata is interleaved if the request has Icy-MetaData: 1.
+func (b *Broadcaster) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	l := b.subscribe()
+	if l == nil {
+		http.Error(w, "stream is over", http.StatusServiceUnavailable)
+		return
+	}
+	defer b.unsubscribe(l)
+
+	h := w.Header()
+	h.Set("Content-Type", "audio/mpeg")
+	h.Set("Cache-Control", "no-cache")
+	for name, value := range map[string]string{
+		"icy-name":  b.cfg.Name,
+		"icy-genre": b.cfg.Genre,
+		"icy-url":   b.cfg.URL,
+	} {
+		if value != "" {
+			h.Set(name, value)
+		}
+	}
+	if b.cfg.Bitrate > 0 {
+		h.Set("icy-br", strconv.Itoa(b.cfg.Bitrate))
+	}
+	var out io.Writer = w
+	if req.Header.Get("Icy-MetaData") == "1" {
+		h.Set("icy-metaint", strconv.Itoa(b.cfg.MetaInt))
+		out = NewWriter(w, b.cfg.MetaInt, &b.title)
+	}
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodHead {
+		return
+	}
+	// send the headers at once, the first frame may take a while
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case frame, ok := <-l.frames:
+			if !ok {
+				return
+			}
+			if _, err := out.Write(frame); err != nil {
+				return
+			}
+			// write what's queued before flushing
+			for len(l.frames) > 0 {
+				if _, err := out.Write(<-l.frames); err != nil {
+					return
+				}
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func (b *Broadcaster) subscribe() *listener {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	l := &listener{frames: make(chan []byte, b.cfg.BufferSize)}
+	b.listeners[l] = struct{}{}
+	return l
+}
+
+func (b *Broadcaster) unsubscribe(l *listener) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.listeners[l]; ok {
+		b.remove(l)
+	}
+}
+
+// remove disconnects a listener, b.mu must be held
+func (b *Broadcaster) remove(l *listener) {
+	delete(b.listeners, l)
+	close(l.frames)
+}
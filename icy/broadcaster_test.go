@@ -0,0 +1,148 @@
+package icy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/viert/go-lame/internal/mp3test"
+)
+
+func waitListeners(t *testing.T, b *Broadcaster, n int) {
+	for i := 0; i < 100 && b.Listeners() != n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if b.Listeners() != n {
+		t.Fatalf("expected %d listeners, got %d", n, b.Listeners())
+	}
+}
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster(Config{MetaInt: 1000, Name: "Radio"})
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Icy-MetaData", "1")
+	withMeta, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer withMeta.Body.Close()
+	plain, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Body.Close()
+	waitListeners(t, b, 2)
+
+	if withMeta.Header.Get("icy-metaint") != "1000" || withMeta.Header.Get("icy-name") != "Radio" {
+		t.Errorf("unexpected headers %v", withMeta.Header)
+	}
+	if plain.Header.Get("icy-metaint") != "" {
+		t.Error("metaint is not expected without Icy-MetaData")
+	}
+
+	b.SetTitle("Now Playing")
+	data, audio := mp3test.Stream(5)
+	if _, err := b.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if _, err := b.Write(data); err != ErrClosed {
+		t.Errorf("expected ErrClosed writing to a closed broadcaster, got %v", err)
+	}
+
+	got, _ := ioutil.ReadAll(plain.Body)
+	if !bytes.Equal(got, audio) {
+		t.Errorf("plain listener got %d bytes, expected %d", len(got), len(audio))
+	}
+
+	r := bufio.NewReader(withMeta.Body)
+	metaint, _ := strconv.Atoi(withMeta.Header.Get("icy-metaint"))
+	var received []byte
+	for i := 0; ; i++ {
+		chunk := make([]byte, metaint)
+		n, _ := io.ReadFull(r, chunk)
+		received = append(received, chunk[:n]...)
+		if n < metaint {
+			break
+		}
+		length, _ := r.ReadByte()
+		block := make([]byte, int(length)*blockUnit)
+		io.ReadFull(r, block)
+		if i == 0 && !bytes.Equal(append([]byte{length}, block...), Metadata("Now Playing")) {
+			t.Errorf("unexpected first metadata block %q", block)
+		}
+		if i > 0 && length != 0 {
+			t.Errorf("metadata block %d is expected to be empty", i)
+		}
+	}
+	if !bytes.Equal(received, audio) {
+		t.Errorf("metadata listener got %d bytes of audio, expected %d", len(received), len(audio))
+	}
+}
+
+func TestBroadcasterSlowListener(t *testing.T) {
+	b := NewBroadcaster(Config{BufferSize: 2})
+	slow := b.subscribe()
+	fast := b.subscribe()
+
+	_, audio := mp3test.Stream(3)
+	for i := 0; i < 3; i++ {
+		b.Write(audio[:mp3test.FrameSize])
+		<-fast.frames
+	}
+	if b.Listeners() != 1 {
+		t.Errorf("the slow listener is expected to be dropped, %d listeners left", b.Listeners())
+	}
+	queued := 0
+	for range slow.frames {
+		queued++
+	}
+	if queued != 2 {
+		t.Errorf("the slow listener is expected to keep 2 queued frames, got %d", queued)
+	}
+	b.unsubscribe(slow)
+	b.unsubscribe(fast)
+	if b.Listeners() != 0 {
+		t.Errorf("expected no listeners, got %d", b.Listeners())
+	}
+}
+
+func TestBroadcasterTitleRace(t *testing.T) {
+	b := NewBroadcaster(Config{MetaInt: 100})
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Icy-MetaData", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	waitListeners(t, b, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			b.SetTitle("Title " + strconv.Itoa(i))
+		}
+	}()
+	data, _ := mp3test.Stream(50)
+	b.Write(data)
+	<-done
+	b.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if b.Title() != "Title 99" {
+		t.Errorf("unexpected title %q", b.Title())
+	}
+}
@@ -0,0 +1,128 @@
+// Package icy serves MP3 streams with ICY (SHOUTcast) metadata
+//  Clients sending Icy-MetaData: 1 get a metadata block after every metaint
+//  bytes of audio. The block is a length byte in 16 byte units followed by
+//  StreamTitle='...'; padded with zeros, an empty block is a single zero byte.
+package icy
+
+import (
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultMetaInt is the number of audio bytes between metadata blocks used by default
+const DefaultMetaInt = 16000
+
+// metadata blocks are up to 255 units of 16 bytes
+const (
+	blockUnit    = 16
+	maxBlockSize = 255 * blockUnit
+)
+
+// Title is the stream title shared by writers, it's safe for concurrent use
+type Title struct {
+	mu    sync.RWMutex
+	value string
+	// version is incremented on every Set, so writers know they're out of date
+	version uint64
+}
+
+// Set changes the title, writers send it with their next metadata block
+func (t *Title) Set(title string) {
+	t.mu.Lock()
+	t.value = title
+	t.version++
+	t.mu.Unlock()
+}
+
+// Get returns the current title
+func (t *Title) Get() string {
+	title, _ := t.get()
+	return title
+}
+
+func (t *Title) get() (string, uint64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.value, t.version
+}
+
+// Metadata returns a metadata block with the StreamTitle
+//  The title is truncated to fit the block size limit.
+func Metadata(title string) []byte {
+	const prefix, suffix = "StreamTitle='", "';"
+	if max := maxBlockSize - 1 - len(prefix) - len(suffix); len(title) > max {
+		title = title[:max]
+		for len(title) > 0 && !utf8.ValidString(title) {
+			title = title[:len(title)-1]
+		}
+	}
+	size := len(prefix) + len(title) + len(suffix)
+	units := (size + blockUnit - 1) / blockUnit
+	block := make([]byte, 1+units*blockUnit)
+	block[0] = byte(units)
+	copy(block[1:], prefix+title+suffix)
+	return block
+}
+
+// Writer inserts metadata blocks into the audio stream written into it
+//  The title is sent in the first block and after it changes,
+//  the other blocks are empty.
+type Writer struct {
+	w       io.Writer
+	metaint int
+	title   *Title
+	// n is the number of audio bytes written since the last block
+	n    int
+	sent uint64
+}
+
+// NewWriter creates a writer inserting a block every metaint bytes,
+// title may be nil if it never changes from empty
+func NewWriter(w io.Writer, metaint int, title *Title) *Writer {
+	if metaint <= 0 {
+		metaint = DefaultMetaInt
+	}
+	return &Writer{w: w, metaint: metaint, title: title}
+}
+
+// Write writes p splitting it with metadata blocks, the number of
+// audio bytes written is returned
+func (w *Writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		k := w.metaint - w.n
+		if k > len(p) {
+			k = len(p)
+		}
+		n, err := w.w.Write(p[:k])
+		written += n
+		w.n += n
+		if err != nil {
+			return written, err
+		}
+		if n < k {
+			return written, io.ErrShortWrite
+		}
+		p = p[k:]
+		if w.n == w.metaint {
+			if err := w.writeMetadata(); err != nil {
+				return written, err
+			}
+			w.n = 0
+		}
+	}
+	return written, nil
+}
+
+func (w *Writer) writeMetadata() error {
+	block := []byte{0}
+	if w.title != nil {
+		if title, version := w.title.get(); version != w.sent {
+			block = Metadata(title)
+			w.sent = version
+		}
+	}
+	_, err := w.w.Write(block)
+	return err
+}
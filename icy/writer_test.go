@@ -0,0 +1,57 @@
+package icy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	block := Metadata("Artist - Title")
+	// StreamTitle='Artist - Title'; is 29 bytes padded to 32
+	if len(block) != 33 || block[0] != 2 {
+		t.Fatalf("unexpected block size %d with length byte %d", len(block), block[0])
+	}
+	if !bytes.Equal(bytes.TrimRight(block[1:], "\x00"), []byte("StreamTitle='Artist - Title';")) {
+		t.Errorf("unexpected block %q", block)
+	}
+
+	block = Metadata(strings.Repeat("я", 3000))
+	if len(block) != 1+maxBlockSize || block[0] != 255 {
+		t.Errorf("long title block is %d bytes with length byte %d", len(block), block[0])
+	}
+	if !bytes.HasSuffix(bytes.TrimRight(block, "\x00"), []byte("я';")) {
+		t.Error("long title is expected to be truncated on a character boundary")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var title Title
+	title.Set("First")
+	out := new(bytes.Buffer)
+	w := NewWriter(out, 10, &title)
+
+	audio := bytes.Repeat([]byte{'a'}, 25)
+	if n, err := w.Write(audio[:7]); n != 7 || err != nil {
+		t.Fatalf("Write returned %d, %v", n, err)
+	}
+	if n, err := w.Write(audio[7:]); n != 18 || err != nil {
+		t.Fatalf("Write returned %d, %v", n, err)
+	}
+	title.Set("Second")
+	w.Write(bytes.Repeat([]byte{'a'}, 15))
+
+	var expected []byte
+	expected = append(expected, audio[:10]...)
+	expected = append(expected, Metadata("First")...)
+	expected = append(expected, audio[:10]...)
+	// the title hasn't changed
+	expected = append(expected, 0)
+	expected = append(expected, audio[:10]...)
+	expected = append(expected, Metadata("Second")...)
+	expected = append(expected, audio[:10]...)
+	expected = append(expected, 0)
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("unexpected stream\n%q\nexpected\n%q", out.Bytes(), expected)
+	}
+}
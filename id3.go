@@ -8,31 +8,70 @@ package lame
 import "C"
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strconv"
 	"unsafe"
+
+	"github.com/viert/go-lame/id3"
 )
 
 const (
 	tagBufferSizeInitial = 32768
+	defaultID3Padding    = 128
+	id3DefaultLanguage   = "XXX"
+)
+
+// id3Fields keeps the values set through ID3TagSet* methods
+// to generate tags in Go
+type id3Fields struct {
+	title   string
+	artist  string
+	album   string
+	year    string
+	comment string
+	track   string
+	genre   string
+	padding int
+	// genreOther is set when lame fell back to "Other" in the version 1 tag
+	genreOther bool
+}
+
+// ID3 setter errors
+var (
+	ErrID3TrackOutOfRange = errors.New("id3 track value out of range")
+	ErrID3GenreOutOfRange = errors.New("id3 genre number out of range")
+	ErrID3GenreOther      = errors.New("id3 v1 tag set to 'other'")
 )
 
 // InitID3Tag initializes id3 metadata
+//  All the values and frames set before are dropped
 func (e *Encoder) InitID3Tag() {
+	e.id3fields = id3Fields{padding: defaultID3Padding}
+	e.id3frames = nil
+	e.id3v1Only = false
+	e.id3v2Only = false
 	C.id3tag_init(e.lgf)
 }
 
 // ID3TagAddV2 forces addition of version 2 tag
 func (e *Encoder) ID3TagAddV2() {
+	e.id3v1Only = false
 	C.id3tag_add_v2(e.lgf)
 }
 
 // ID3TagV1Only sets addition of only a version 1 tag
 func (e *Encoder) ID3TagV1Only() {
+	e.id3v1Only = true
+	e.id3v2Only = false
 	C.id3tag_v1_only(e.lgf)
 }
 
 // ID3TagV2Only sets addition of only a version 2 tag
 func (e *Encoder) ID3TagV2Only() {
+	e.id3v1Only = false
+	e.id3v2Only = true
 	C.id3tag_v2_only(e.lgf)
 }
 
@@ -43,11 +82,13 @@ func (e *Encoder) ID3TagSpaceV1() {
 
 // ID3TagPadV2 pads version 2 tag with extra 128 bytes
 func (e *Encoder) ID3TagPadV2() {
+	e.id3fields.padding = defaultID3Padding
 	C.id3tag_pad_v2(e.lgf)
 }
 
 // ID3TagSetPad pads version 2 tag with extra n bytes
 func (e *Encoder) ID3TagSetPad(n int) {
+	e.id3fields.padding = n
 	C.id3tag_set_pad(e.lgf, C.size_t(n))
 }
 
@@ -56,6 +97,7 @@ func (e *Encoder) ID3TagSetTitle(value string) {
 	cstr := C.CString(value)
 	defer C.free(unsafe.Pointer(cstr))
 	C.id3tag_set_title(e.lgf, cstr)
+	e.id3fields.title = value
 }
 
 // ID3TagSetArtist sets id3 artist
@@ -63,6 +105,7 @@ func (e *Encoder) ID3TagSetArtist(value string) {
 	cstr := C.CString(value)
 	defer C.free(unsafe.Pointer(cstr))
 	C.id3tag_set_artist(e.lgf, cstr)
+	e.id3fields.artist = value
 }
 
 // ID3TagSetAlbum sets id3 album
@@ -70,6 +113,7 @@ func (e *Encoder) ID3TagSetAlbum(value string) {
 	cstr := C.CString(value)
 	defer C.free(unsafe.Pointer(cstr))
 	C.id3tag_set_album(e.lgf, cstr)
+	e.id3fields.album = value
 }
 
 // ID3TagSetYear sets id3 year
@@ -77,6 +121,7 @@ func (e *Encoder) ID3TagSetYear(value string) {
 	cstr := C.CString(value)
 	defer C.free(unsafe.Pointer(cstr))
 	C.id3tag_set_year(e.lgf, cstr)
+	e.id3fields.year = value
 }
 
 // ID3TagSetComment sets id3 comment
@@ -84,6 +129,7 @@ func (e *Encoder) ID3TagSetComment(value string) {
 	cstr := C.CString(value)
 	defer C.free(unsafe.Pointer(cstr))
 	C.id3tag_set_comment(e.lgf, cstr)
+	e.id3fields.comment = value
 }
 
 // ID3TagSetTrack sets id3 track
@@ -94,8 +140,9 @@ func (e *Encoder) ID3TagSetTrack(value string) error {
 	defer C.free(unsafe.Pointer(cstr))
 	errcode := C.id3tag_set_track(e.lgf, cstr)
 	if errcode == -1 {
-		return fmt.Errorf("id3 track value out of range")
+		return ErrID3TrackOutOfRange
 	}
+	e.id3fields.track = value
 	return nil
 }
 
@@ -104,16 +151,95 @@ func (e *Encoder) ID3TagSetGenre(value string) error {
 	cstr := C.CString(value)
 	defer C.free(unsafe.Pointer(cstr))
 	errcode := C.id3tag_set_genre(e.lgf, cstr)
+	if errcode != -1 {
+		e.id3fields.genre = value
+		e.id3fields.genreOther = errcode == -2
+	}
 	switch errcode {
 	case -1:
-		return fmt.Errorf("id3 genre number out of range")
+		return ErrID3GenreOutOfRange
 	case -2:
-		return fmt.Errorf("id3 v1 tag set to 'other'")
+		return ErrID3GenreOther
 	default:
 		return nil
 	}
 }
 
+// ID3TagSetFrame adds a version 2 frame lame can't produce itself
+//  A frame of the same kind set before is replaced, i.e. a frame with the same id
+//  and, for frames which may appear multiple times in a tag, the same
+//  description, owner or picture type.
+//  Setting any frame makes the tag to be written by Encoder, see AddChapter.
+func (e *Encoder) ID3TagSetFrame(f id3.Frame) {
+	key := id3FrameKey(f)
+	for i, existing := range e.id3frames {
+		if id3FrameKey(existing) == key {
+			e.id3frames[i] = f
+			return
+		}
+	}
+	e.id3frames = append(e.id3frames, f)
+}
+
+// removeID3Frame removes a frame set with ID3TagSetFrame by its key
+func (e *Encoder) removeID3Frame(key string) {
+	for i, f := range e.id3frames {
+		if id3FrameKey(f) == key {
+			e.id3frames = append(e.id3frames[:i], e.id3frames[i+1:]...)
+			return
+		}
+	}
+}
+
+// ID3TagSetPrivate sets a private PRIV frame identified by its owner
+//  Owner is usually an URL or an email address of the organisation
+//  responsible for the frame. Frames of different owners are kept
+//  separately, nil data removes the frame.
+func (e *Encoder) ID3TagSetPrivate(owner string, data []byte) {
+	f := &id3.PrivateFrame{Owner: owner, Data: data}
+	if data == nil {
+		e.removeID3Frame(id3FrameKey(f))
+		return
+	}
+	e.ID3TagSetFrame(f)
+}
+
+// ID3TagSetUniqueFileID sets a unique file identifier UFID frame, e.g.
+//  ID3TagSetUniqueFileID("http://musicbrainz.org", []byte(recordingID))
+//  The identifier can't be longer than id3.MaxUFIDSize, nil id removes the frame.
+func (e *Encoder) ID3TagSetUniqueFileID(owner string, id []byte) error {
+	if len(id) > id3.MaxUFIDSize {
+		return id3.ErrUFIDTooLong
+	}
+	f := &id3.UniqueFileIDFrame{Owner: owner, Identifier: id}
+	if id == nil {
+		e.removeID3Frame(id3FrameKey(f))
+		return nil
+	}
+	e.ID3TagSetFrame(f)
+	return nil
+}
+
+// id3FrameKey identifies frames which can't appear in a tag twice
+func id3FrameKey(f id3.Frame) string {
+	switch v := f.(type) {
+	case *id3.UserTextFrame:
+		return "TXXX:" + v.Description
+	case *id3.UserURLFrame:
+		return "WXXX:" + v.Description
+	case *id3.CommentFrame:
+		return v.FrameID + ":" + v.Language + ":" + v.Description
+	case *id3.PictureFrame:
+		return "APIC:" + strconv.Itoa(int(v.PictureType))
+	case *id3.PrivateFrame:
+		return "PRIV:" + v.Owner
+	case *id3.UniqueFileIDFrame:
+		return "UFID:" + v.Owner
+	default:
+		return f.ID()
+	}
+}
+
 // ID3V1Tag returns version 1 id3 tag
 func (e *Encoder) ID3V1Tag() []byte {
 	buffer := make([]byte, tagBufferSizeInitial)
@@ -129,7 +255,25 @@ func (e *Encoder) ID3V1Tag() []byte {
 }
 
 // ID3V2Tag returns version 2 id3 tag
+//  Frames lame can't produce itself, like chapters, are merged
+//  into the tag lame generates. ID3v2.4 tag is generated in Go,
+//  see SetID3V2Version. Nil is returned if the tag can't be built,
+//  e.g. a frame is too large, Write returns the error then.
 func (e *Encoder) ID3V2Tag() []byte {
+	tag, _ := e.id3V2Tag()
+	return tag
+}
+
+// id3V2Tag returns version 2 id3 tag or the error building it
+func (e *Encoder) id3V2Tag() ([]byte, error) {
+	if !e.id3Managed() {
+		return e.lameID3V2Tag(), nil
+	}
+	return e.customID3V2Tag()
+}
+
+// lameID3V2Tag returns version 2 id3 tag generated by lame
+func (e *Encoder) lameID3V2Tag() []byte {
 	buffer := make([]byte, tagBufferSizeInitial)
 	bptr := (*C.uchar)(&buffer[0])
 	reqsize := int(C.lame_get_id3v2_tag(e.lgf, bptr, tagBufferSizeInitial))
@@ -142,6 +286,31 @@ func (e *Encoder) ID3V2Tag() []byte {
 	return buffer
 }
 
+// genreName resolves numeric genre values to genre names
+func (f id3Fields) genreName() string {
+	if n, err := strconv.Atoi(f.genre); err == nil && id3.GenreName(n) != "" {
+		return id3.GenreName(n)
+	}
+	return f.genre
+}
+
+// SetID3V2Version sets the version of ID3v2 tag produced
+//  3 - lame's own ID3v2.3 tag writer is used, default
+//  4 - ID3v2.4 tag with UTF-8 text frames is generated in Go from the values
+//      set through ID3TagSet* methods, year is written as TDRC frame
+func (e *Encoder) SetID3V2Version(version int) error {
+	if version != 3 && version != 4 {
+		return fmt.Errorf("unsupported id3 version 2.%d", version)
+	}
+	e.id3version = version
+	return nil
+}
+
+// ID3V2Version returns the version of ID3v2 tag produced
+func (e *Encoder) ID3V2Version() int {
+	return e.id3version
+}
+
 // SetWriteID3TagAutomatic sets automatic write of id3 tag
 //   Normaly lame_init_param writes ID3v2 tags into the audio stream.
 //   Here in Encoder lame_init_param is launched on first write to encoder instance.
@@ -153,13 +322,109 @@ func (e *Encoder) SetWriteID3TagAutomatic(auto bool) {
 	if auto {
 		value = 1
 	}
+	e.id3auto = auto
 	C.lame_set_write_id3tag_automatic(e.lgf, C.int(value))
 }
 
 // WriteID3TagAutomatic returns current automatic tag write flag
 func (e *Encoder) WriteID3TagAutomatic() bool {
-	res := C.lame_get_write_id3tag_automatic(e.lgf)
-	return res == 1
+	return e.id3auto
+}
+
+// id3Managed reports whether ID3v2 tag is generated by Encoder rather than lame
+func (e *Encoder) id3Managed() bool {
+	return e.id3version == 4 || len(e.id3frames) > 0 || len(e.chapters) > 0
+}
+
+// customID3Frames returns frames to be added to the tag lame generates
+func (e *Encoder) customID3Frames() []id3.Frame {
+	frames := append([]id3.Frame{}, e.id3frames...)
+	return append(frames, e.chapterFrames()...)
+}
+
+// customID3V2Tag generates ID3v2 tag with custom frames
+//  ID3v2.3 tags are based on the tag lame generates, ID3v2.4 tags
+//  are built from the values set through ID3TagSet* methods
+func (e *Encoder) customID3V2Tag() ([]byte, error) {
+	if e.id3v1Only {
+		return nil, nil
+	}
+
+	var tag *id3.V2
+	if e.id3version == 4 {
+		tag = e.fieldsID3V2Tag()
+	} else {
+		// lame only produces a version 2 tag when it's necessary
+		// for the fields set, the custom frames need it anyway
+		C.id3tag_add_v2(e.lgf)
+
+		tag = &id3.V2{Version: 3}
+		if data := e.lameID3V2Tag(); len(data) > 0 {
+			var err error
+			tag, err = id3.ReadV2(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tag.Frames = append(tag.Frames, e.customID3Frames()...)
+	if len(tag.Frames) == 0 {
+		return nil, nil
+	}
+	return tag.Bytes()
+}
+
+// fieldsID3V2Tag builds ID3v2.4 tag from the values set through ID3TagSet* methods
+func (e *Encoder) fieldsID3V2Tag() *id3.V2 {
+	f := e.id3fields
+	tag := &id3.V2{Version: 4, Padding: f.padding}
+	text := func(id string, value string) {
+		if value != "" {
+			tag.Frames = append(tag.Frames, &id3.TextFrame{
+				FrameID:  id,
+				Encoding: id3.EncodingUTF8,
+				Values:   []string{value},
+			})
+		}
+	}
+
+	text("TIT2", f.title)
+	text("TPE1", f.artist)
+	text("TALB", f.album)
+	text("TDRC", f.year)
+	text("TRCK", f.track)
+	text("TCON", f.genreName())
+	if f.comment != "" {
+		tag.Frames = append(tag.Frames, &id3.CommentFrame{
+			FrameID:  "COMM",
+			Encoding: id3.EncodingUTF8,
+			Language: id3DefaultLanguage,
+			Text:     f.comment,
+		})
+	}
+	if len(tag.Frames) > 0 {
+		text("TSSE", "LAME "+C.GoString(C.get_lame_short_version()))
+	}
+	return tag
+}
+
+// writeID3V2Tag writes version 2 tag to the output
+//  It's called on init when the tag is written by Encoder rather than lame
+func (e *Encoder) writeID3V2Tag() error {
+	tag, err := e.id3V2Tag()
+	if err != nil {
+		return err
+	}
+	_, err = e.output.Write(tag)
+	return err
+}
+
+// writeID3V1Tag writes version 1 tag to the output
+//  It's called on flush when the tag is written by Encoder rather than lame
+func (e *Encoder) writeID3V1Tag() error {
+	_, err := e.output.Write(e.ID3V1Tag())
+	return err
 }
 
 // LameTagFrame returns the final LAME-tag frame
@@ -0,0 +1,141 @@
+package id3
+
+import (
+	"encoding/binary"
+)
+
+// NoOffset is a ChapterFrame offset value meaning that times should be used instead
+const NoOffset = 0xffffffff
+
+// TOC frame flags
+const (
+	tocFlagOrdered  = 0x01
+	tocFlagTopLevel = 0x02
+)
+
+// ChapterFrame represents a chapter frame CHAP of the ID3v2 Chapter Frame Addendum
+type ChapterFrame struct {
+	ElementID string
+	// StartTime and EndTime are given in milliseconds
+	StartTime uint32
+	EndTime   uint32
+	// StartOffset and EndOffset are byte offsets of the chapter
+	// from the beginning of the file, NoOffset if unused
+	StartOffset uint32
+	EndOffset   uint32
+	// Frames are the embedded frames describing the chapter, e.g. TIT2 or APIC
+	Frames []Frame
+}
+
+// ID returns the frame id
+func (f *ChapterFrame) ID() string { return "CHAP" }
+
+// Title returns the value of the embedded TIT2 frame
+func (f *ChapterFrame) Title() string {
+	return subframeText(f.Frames, "TIT2")
+}
+
+func (f *ChapterFrame) encode(version byte) ([]byte, error) {
+	b := EncodingISO88591.encodeTerminated(f.ElementID)
+	var times [16]byte
+	binary.BigEndian.PutUint32(times[0:], f.StartTime)
+	binary.BigEndian.PutUint32(times[4:], f.EndTime)
+	binary.BigEndian.PutUint32(times[8:], f.StartOffset)
+	binary.BigEndian.PutUint32(times[12:], f.EndOffset)
+	b = append(b, times[:]...)
+	return appendFrames(b, f.Frames, version)
+}
+
+// TOCFrame represents a table of contents frame CTOC of the ID3v2 Chapter Frame Addendum
+type TOCFrame struct {
+	ElementID string
+	TopLevel  bool
+	Ordered   bool
+	// ChildElementIDs lists element ids of chapters or nested tables of contents
+	ChildElementIDs []string
+	// Frames are the embedded frames describing the table of contents
+	Frames []Frame
+}
+
+// ID returns the frame id
+func (f *TOCFrame) ID() string { return "CTOC" }
+
+// Title returns the value of the embedded TIT2 frame
+func (f *TOCFrame) Title() string {
+	return subframeText(f.Frames, "TIT2")
+}
+
+func (f *TOCFrame) encode(version byte) ([]byte, error) {
+	b := EncodingISO88591.encodeTerminated(f.ElementID)
+	var flags byte
+	if f.TopLevel {
+		flags |= tocFlagTopLevel
+	}
+	if f.Ordered {
+		flags |= tocFlagOrdered
+	}
+	if len(f.ChildElementIDs) > 255 {
+		return nil, ErrTagTooLarge
+	}
+	b = append(b, flags, byte(len(f.ChildElementIDs)))
+	for _, child := range f.ChildElementIDs {
+		b = append(b, EncodingISO88591.encodeTerminated(child)...)
+	}
+	return appendFrames(b, f.Frames, version)
+}
+
+func (t *V2) decodeChapterFrame(data []byte) Frame {
+	id, rest := EncodingISO88591.split(data)
+	if len(rest) < 16 {
+		return nil
+	}
+	frames, _, err := t.parseFrames(rest[16:])
+	if err != nil {
+		return nil
+	}
+	return &ChapterFrame{
+		ElementID:   string(id),
+		StartTime:   binary.BigEndian.Uint32(rest[0:]),
+		EndTime:     binary.BigEndian.Uint32(rest[4:]),
+		StartOffset: binary.BigEndian.Uint32(rest[8:]),
+		EndOffset:   binary.BigEndian.Uint32(rest[12:]),
+		Frames:      frames,
+	}
+}
+
+func (t *V2) decodeTOCFrame(data []byte) Frame {
+	id, rest := EncodingISO88591.split(data)
+	if len(rest) < 2 {
+		return nil
+	}
+	f := &TOCFrame{
+		ElementID: string(id),
+		TopLevel:  rest[0]&tocFlagTopLevel != 0,
+		Ordered:   rest[0]&tocFlagOrdered != 0,
+	}
+	count := int(rest[1])
+	rest = rest[2:]
+	for i := 0; i < count; i++ {
+		var child []byte
+		child, rest = EncodingISO88591.split(rest)
+		if rest == nil && i < count-1 {
+			return nil
+		}
+		f.ChildElementIDs = append(f.ChildElementIDs, string(child))
+	}
+	frames, _, err := t.parseFrames(rest)
+	if err != nil {
+		return nil
+	}
+	f.Frames = frames
+	return f
+}
+
+func subframeText(frames []Frame, id string) string {
+	for _, f := range frames {
+		if text, ok := f.(*TextFrame); ok && text.FrameID == id {
+			return text.Text()
+		}
+	}
+	return ""
+}
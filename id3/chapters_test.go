@@ -0,0 +1,74 @@
+package id3
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestChaptersRoundTrip(t *testing.T) {
+	for _, version := range []byte{3, 4} {
+		v2 := &V2{Version: version}
+		v2.Frames = append(v2.Frames,
+			&TOCFrame{
+				ElementID:       "toc",
+				TopLevel:        true,
+				Ordered:         true,
+				ChildElementIDs: []string{"chp0", "chp1"},
+			},
+			&ChapterFrame{
+				ElementID:   "chp0",
+				StartTime:   0,
+				EndTime:     1500,
+				StartOffset: NoOffset,
+				EndOffset:   NoOffset,
+				Frames:      []Frame{&TextFrame{FrameID: "TIT2", Values: []string{"Intro"}}},
+			},
+			&ChapterFrame{
+				ElementID:   "chp1",
+				StartTime:   1500,
+				EndTime:     3000,
+				StartOffset: NoOffset,
+				EndOffset:   NoOffset,
+				Frames: []Frame{
+					&TextFrame{FrameID: "TIT2", Values: []string{"Главная часть"}},
+					&PictureFrame{MIMEType: "image/png", PictureType: PictureOther, Data: []byte{1, 2}},
+				},
+			},
+		)
+		data, err := v2.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag, err := ReadV2(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		toc, ok := tag.Frame("CTOC").(*TOCFrame)
+		if !ok {
+			t.Fatalf("ID3v2.%d CTOC frame not found", version)
+		}
+		if !toc.TopLevel || !toc.Ordered || !reflect.DeepEqual(toc.ChildElementIDs, []string{"chp0", "chp1"}) {
+			t.Errorf("ID3v2.%d unexpected table of contents %+v", version, toc)
+		}
+
+		chapters := tag.FramesByID("CHAP")
+		if len(chapters) != 2 {
+			t.Fatalf("ID3v2.%d has %d chapters, expected 2", version, len(chapters))
+		}
+		chp, ok := chapters[1].(*ChapterFrame)
+		if !ok {
+			t.Fatalf("ID3v2.%d chapter is %T", version, chapters[1])
+		}
+		if chp.ElementID != "chp1" || chp.StartTime != 1500 || chp.EndTime != 3000 || chp.StartOffset != NoOffset {
+			t.Errorf("ID3v2.%d unexpected chapter %+v", version, chp)
+		}
+		if chp.Title() != "Главная часть" {
+			t.Errorf("ID3v2.%d chapter title is %q", version, chp.Title())
+		}
+		if len(chp.Frames) != 2 || chp.Frames[1].ID() != "APIC" {
+			t.Errorf("ID3v2.%d chapter image not found", version)
+		}
+	}
+}
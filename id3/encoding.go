@@ -0,0 +1,178 @@
+package id3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is an ID3v2 text encoding
+type Encoding byte
+
+// ID3v2 text encodings
+const (
+	EncodingISO88591 Encoding = 0
+	EncodingUTF16    Encoding = 1 /* UTF-16 with BOM */
+	EncodingUTF16BE  Encoding = 2 /* ID3v2.4 only */
+	EncodingUTF8     Encoding = 3 /* ID3v2.4 only */
+)
+
+func (e Encoding) terminatorSize() int {
+	if e == EncodingUTF16 || e == EncodingUTF16BE {
+		return 2
+	}
+	return 1
+}
+
+// split cuts b at the first string terminator
+//  rest is nil if there's no terminator in b
+func (e Encoding) split(b []byte) (field []byte, rest []byte) {
+	if e.terminatorSize() == 1 {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			return b[:i], b[i+1:]
+		}
+		return b, nil
+	}
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			return b[:i], b[i+2:]
+		}
+	}
+	return b, nil
+}
+
+// decode converts a single encoded string to UTF-8
+func (e Encoding) decode(b []byte) string {
+	switch e {
+	case EncodingISO88591:
+		return string(latin1ToUTF8(b))
+	case EncodingUTF16:
+		var order binary.ByteOrder = binary.LittleEndian
+		if len(b) >= 2 {
+			switch {
+			case b[0] == 0xfe && b[1] == 0xff:
+				order = binary.BigEndian
+				b = b[2:]
+			case b[0] == 0xff && b[1] == 0xfe:
+				b = b[2:]
+			}
+		}
+		return decodeUTF16(b, order)
+	case EncodingUTF16BE:
+		return decodeUTF16(b, binary.BigEndian)
+	default:
+		return string(b)
+	}
+}
+
+// decodeStrings splits b into terminated strings and decodes each of them
+func (e Encoding) decodeStrings(b []byte) []string {
+	var values []string
+	for len(b) > 0 {
+		var field []byte
+		field, b = e.split(b)
+		values = append(values, e.decode(field))
+	}
+	// trailing terminators are padding rather than empty values
+	for len(values) > 1 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+// forVersion returns an encoding suitable for values in a tag of the given version
+//  Encodings not supported by ID3v2.3 are replaced and latin1 is upgraded
+//  to a unicode encoding if values can't be represented in latin1
+func (e Encoding) forVersion(version byte, values ...string) Encoding {
+	latin1 := true
+	for _, v := range values {
+		if !isLatin1(v) {
+			latin1 = false
+			break
+		}
+	}
+	if version >= 4 {
+		if e > EncodingUTF8 || (e == EncodingISO88591 && !latin1) {
+			return EncodingUTF8
+		}
+		return e
+	}
+	if e == EncodingISO88591 || e > EncodingUTF16 {
+		if latin1 {
+			return EncodingISO88591
+		}
+		return EncodingUTF16
+	}
+	return e
+}
+
+// encode converts s to the encoding without a terminator
+func (e Encoding) encode(s string) []byte {
+	switch e {
+	case EncodingISO88591:
+		return utf8ToLatin1(s)
+	case EncodingUTF16:
+		return append([]byte{0xff, 0xfe}, encodeUTF16(s, binary.LittleEndian)...)
+	case EncodingUTF16BE:
+		return encodeUTF16(s, binary.BigEndian)
+	default:
+		return []byte(s)
+	}
+}
+
+// encodeTerminated converts s to the encoding and appends a terminator
+func (e Encoding) encodeTerminated(s string) []byte {
+	return append(e.encode(s), e.terminator()...)
+}
+
+// terminator returns the string terminator, it separates multiple values too
+func (e Encoding) terminator() []byte {
+	return make([]byte, e.terminatorSize())
+}
+
+func encodeUTF16(s string, order binary.ByteOrder) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		order.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+func decodeUTF16(b []byte, order binary.ByteOrder) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
+
+func latin1ToUTF8(b []byte) []byte {
+	buf := make([]byte, 0, len(b))
+	for _, c := range b {
+		buf = append(buf, string(rune(c))...)
+	}
+	return buf
+}
+
+// utf8ToLatin1 converts s to latin1 replacing unsupported characters with '?'
+func utf8ToLatin1(s string) []byte {
+	buf := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff || r == utf8.RuneError {
+			r = '?'
+		}
+		buf = append(buf, byte(r))
+	}
+	return buf
+}
+
+func isLatin1(s string) bool {
+	for _, r := range s {
+		if r > 0xff || r == utf8.RuneError {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package id3
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// UpdateFile reads the tags of an MP3 file, passes them to fn and writes them back
+//  A Tag with both V1 and V2 set to nil is passed to fn if the file has no tags.
+//  See WriteFile for details on how the tags are written.
+func UpdateFile(path string, fn func(*Tag) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	tag, err := Read(f)
+	f.Close()
+	if err == ErrNoTag {
+		tag = new(Tag)
+	} else if err != nil {
+		return err
+	}
+
+	if err = fn(tag); err != nil {
+		return err
+	}
+	return WriteFile(path, tag)
+}
+
+// WriteFile replaces the ID3v2 and ID3v1 tags of an MP3 file
+//  The audio data is never touched. A nil V2 or V1 removes the corresponding tag.
+//
+//  The new ID3v2 tag is written in place if it fits into the space occupied
+//  by the existing one, the rest of that space becomes padding.
+//  Otherwise the file is rewritten: the new tag and the audio frames are
+//  streamed to a temporary file in the same directory which then replaces
+//  the original one. tag.V2.Padding is kept in that case to leave room
+//  for future in-place edits.
+func WriteFile(path string, tag *Tag) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	v2size, appendedSize, v1size, end, err := tagSizes(f)
+	if err != nil {
+		return err
+	}
+
+	var v1 []byte
+	if tag.V1 != nil {
+		v1 = tag.V1.Bytes()
+	}
+
+	var v2 []byte
+	if tag.V2 != nil {
+		// try to fit the tag into the existing space first
+		fitted := *tag.V2
+		fitted.Padding = 0
+		fitted.Flags &^= FlagFooter
+		if v2, err = fitted.Bytes(); err != nil {
+			return err
+		}
+		if v2size > 0 && len(v2) <= v2size {
+			fitted.Padding = v2size - len(v2)
+			if v2, err = fitted.Bytes(); err != nil {
+				return err
+			}
+		} else if v2, err = tag.V2.Bytes(); err != nil {
+			return err
+		}
+	}
+
+	// an appended tag is dropped as the new one is written at the beginning
+	audioEnd := end - int64(v1size) - int64(appendedSize)
+	if len(v2) != v2size || appendedSize > 0 {
+		return rewriteFile(f, path, v2, v1, v2size, audioEnd)
+	}
+
+	if len(v2) > 0 {
+		if _, err = f.WriteAt(v2, 0); err != nil {
+			return err
+		}
+	}
+	if len(v1) > 0 {
+		if _, err = f.WriteAt(v1, audioEnd); err != nil {
+			return err
+		}
+	} else if v1size > 0 {
+		if err = f.Truncate(audioEnd); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+// tagSizes returns the sizes of a leading ID3v2 tag, an appended ID3v2.4 tag,
+// a trailing ID3v1 tag and the file
+//  The appended tag is only looked up if there's no leading one, as Read does.
+func tagSizes(f *os.File) (v2size int, appendedSize int, v1size int, end int64, err error) {
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	header := make([]byte, v2HeaderSize)
+	if _, err = io.ReadFull(f, header); err == nil && string(header[:3]) == "ID3" {
+		size, ok := synchsafe(header[6:10])
+		if !ok {
+			err = ErrInvalidHeader
+			return
+		}
+		v2size = v2HeaderSize + size
+		if header[3] == 4 && header[5]&FlagFooter != 0 {
+			v2size += v2FooterSize
+		}
+	} else if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return
+	}
+
+	if _, err = ReadV1(f); err == nil {
+		v1size = v1TagSize
+	} else if err != ErrNoTag {
+		return
+	}
+
+	if end, err = f.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+	if v2size == 0 {
+		tagEnd := end - int64(v1size)
+		var start int64
+		if start, err = appendedV2Start(f, tagEnd); err == nil {
+			appendedSize = int(tagEnd - start)
+		} else if err != ErrNoTag {
+			return
+		}
+		err = nil
+	}
+	if int64(v2size+appendedSize+v1size) > end {
+		err = ErrInvalidHeader
+	}
+	return
+}
+
+// rewriteFile writes v2, the audio data found between audioStart and audioEnd
+// and v1 to a temporary file which then replaces the original one
+func rewriteFile(f *os.File, path string, v2 []byte, v1 []byte, audioStart int, audioEnd int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err = tmp.Write(v2); err != nil {
+		return err
+	}
+	audio := io.NewSectionReader(f, int64(audioStart), audioEnd-int64(audioStart))
+	if _, err = io.Copy(tmp, audio); err != nil {
+		return err
+	}
+	if _, err = tmp.Write(v1); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(info.Mode()); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
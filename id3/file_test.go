@@ -0,0 +1,215 @@
+package id3
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testAudio = bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64, 0x00, 0x01}, 100)
+
+func tempMP3(t *testing.T, data []byte) (string, func()) {
+	dir, err := ioutil.TempDir("", "id3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.mp3")
+	if err = ioutil.WriteFile(path, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func readMP3(t *testing.T, path string) (*Tag, []byte) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, end := 0, len(data)
+	if tag.V2 != nil {
+		start = tag.V2.Size
+	}
+	if tag.V1 != nil {
+		end -= v1TagSize
+	}
+	return tag, data[start:end]
+}
+
+func TestUpdateFileInPlace(t *testing.T) {
+	v2 := &V2{Version: 3, Padding: 256}
+	v2.SetText("TIT2", "Typo Titel")
+	v2data, err := v2.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := concat(v2data, testAudio, v1Fixture("Typo Titel", "", 1, 0))
+	path, cleanup := tempMP3(t, original)
+	defer cleanup()
+
+	err = UpdateFile(path, func(tag *Tag) error {
+		tag.V2.SetText("TIT2", "Fixed Title")
+		tag.V2.SetText("TPE1", "Артист")
+		tag.V1.Title = "Fixed Title"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, audio := readMP3(t, path)
+	if !bytes.Equal(audio, testAudio) {
+		t.Error("audio data has changed")
+	}
+	if tag.V2.Size != len(v2data) {
+		t.Errorf("tag size is %d, expected in-place update keeping %d", tag.V2.Size, len(v2data))
+	}
+	if tag.V2.Text("TIT2") != "Fixed Title" || tag.V2.Text("TPE1") != "Артист" {
+		t.Errorf("unexpected ID3v2 values %q, %q", tag.V2.Text("TIT2"), tag.V2.Text("TPE1"))
+	}
+	if tag.V1.Title != "Fixed Title" || tag.V1.Track != 1 {
+		t.Errorf("unexpected ID3v1 values %+v", tag.V1)
+	}
+}
+
+func TestUpdateFileRewrite(t *testing.T) {
+	path, cleanup := tempMP3(t, concat(testAudio, v1Fixture("Title", "", 0, 0)))
+	defer cleanup()
+
+	picture := bytes.Repeat([]byte{0xff, 0x00}, 1000)
+	err := UpdateFile(path, func(tag *Tag) error {
+		tag.V2 = &V2{Version: 4, Padding: 128}
+		tag.V2.SetText("TIT2", "Title")
+		tag.V2.Frames = append(tag.V2.Frames, &PictureFrame{
+			MIMEType:    "image/jpeg",
+			PictureType: PictureFrontCover,
+			Data:        picture,
+		})
+		tag.V1 = nil
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, audio := readMP3(t, path)
+	if !bytes.Equal(audio, testAudio) {
+		t.Error("audio data has changed")
+	}
+	if tag.V1 != nil {
+		t.Error("ID3v1 tag is expected to be removed")
+	}
+	if tag.V2 == nil || tag.V2.Version != 4 || tag.V2.Padding != 128 {
+		t.Fatalf("unexpected ID3v2 tag %+v", tag.V2)
+	}
+	apic, ok := tag.V2.Frame("APIC").(*PictureFrame)
+	if !ok || !bytes.Equal(apic.Data, picture) {
+		t.Error("picture doesn't match")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("file mode is %v, expected original mode to be kept", info.Mode())
+	}
+
+	err = WriteFile(path, &Tag{V1: &V1{Title: "Only V1", Genre: v1GenreUnknown}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, audio = readMP3(t, path)
+	if !bytes.Equal(audio, testAudio) {
+		t.Error("audio data has changed")
+	}
+	if tag.V2 != nil || tag.V1 == nil || tag.V1.Title != "Only V1" {
+		t.Errorf("unexpected tags %+v", tag)
+	}
+}
+
+func TestV2RoundTrip(t *testing.T) {
+	for _, version := range []byte{3, 4} {
+		v2 := &V2{Version: version}
+		v2.SetText("TIT2", "Title")
+		v2.SetText("TPE1", "One", "Two")
+		v2.Frames = append(v2.Frames,
+			&CommentFrame{FrameID: "COMM", Language: "eng", Text: "Кириллица"},
+			&UserTextFrame{Description: "key", Value: "value"},
+			&UniqueFileIDFrame{Owner: "owner", Identifier: []byte("id")},
+		)
+		data, err := v2.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag, err := ReadV2(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag.Version != version {
+			t.Errorf("version is %d, expected %d", tag.Version, version)
+		}
+		if tag.Text("TPE1") != "One/Two" {
+			t.Errorf("ID3v2.%d TPE1 is %q", version, tag.Text("TPE1"))
+		}
+		comm, ok := tag.Frame("COMM").(*CommentFrame)
+		if !ok || comm.Text != "Кириллица" {
+			t.Errorf("ID3v2.%d comment doesn't match: %+v", version, tag.Frame("COMM"))
+		}
+		if value, _ := tag.UserText("key"); value != "value" {
+			t.Errorf("ID3v2.%d TXXX is %q", version, value)
+		}
+	}
+
+	v2 := &V2{Version: 4, Frames: []Frame{
+		&TextFrame{FrameID: "TPE1", Encoding: EncodingUTF16, Values: []string{"Один", "Two", "Три"}},
+	}}
+	data, err := v2.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the values are separated with a bare terminator, not an empty string with a BOM
+	if bytes.Contains(data, []byte{0xff, 0xfe, 0, 0}) {
+		t.Errorf("UTF-16 separator is expected to be a terminator only: % x", data)
+	}
+	tag, err := ReadV2(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpe1, ok := tag.Frame("TPE1").(*TextFrame)
+	if !ok || len(tpe1.Values) != 3 || tpe1.Text() != "Один/Two/Три" {
+		t.Errorf("UTF-16 values don't match: %+v", tag.Frame("TPE1"))
+	}
+
+	_, err = (&V2{Frames: []Frame{&UniqueFileIDFrame{Identifier: make([]byte, 65)}}}).Bytes()
+	if err != ErrUFIDTooLong {
+		t.Errorf("expected ErrUFIDTooLong, got %v", err)
+	}
+}
+
+func TestUpdateFileAppended(t *testing.T) {
+	appended := v2Fixture(4, FlagFooter, frameFixture(4, "TIT2", 0, []byte("\x03Appended")))
+	path, cleanup := tempMP3(t, concat(testAudio, appended, v1Fixture("V1", "", 0, 0)))
+	defer cleanup()
+
+	err := UpdateFile(path, func(tag *Tag) error {
+		tag.V2.SetText("TIT2", "Moved")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, audio := readMP3(t, path)
+	if !bytes.Equal(audio, testAudio) {
+		t.Error("the appended tag is expected to be removed from the audio data")
+	}
+	if tag.Title() != "Moved" || tag.V1 == nil {
+		t.Errorf("unexpected tags %+v", tag)
+	}
+}
@@ -0,0 +1,359 @@
+package id3
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxUFIDSize is the maximum size of a UFID frame identifier
+const MaxUFIDSize = 64
+
+// ErrUFIDTooLong is returned on writing a UFID frame with identifier longer than 64 bytes
+var ErrUFIDTooLong = errors.New("id3: UFID identifier is longer than 64 bytes")
+
+// Frame is an ID3v2 frame
+//  Frames which are not covered by the types of this package
+//  can be written using RawFrame
+type Frame interface {
+	// ID returns a four-character frame id
+	ID() string
+	// encode returns the frame body for a tag of the given version
+	encode(version byte) ([]byte, error)
+}
+
+// FrameSize returns the size of the frame body encoded for a tag of the given version
+//  Bodies larger than MaxFrameSize can't be written
+func FrameSize(f Frame, version byte) (int, error) {
+	data, err := f.encode(version)
+	return len(data), err
+}
+
+// TextFrame represents text information frames T000-TZZZ except TXXX
+//  iTunes podcast feed URL frame WFED is represented by this type too
+type TextFrame struct {
+	FrameID  string
+	Encoding Encoding
+	// Values contains all the null-separated strings of the frame
+	Values []string
+}
+
+// ID returns the frame id
+func (f *TextFrame) ID() string { return f.FrameID }
+
+// Text returns the frame values joined with "/"
+func (f *TextFrame) Text() string { return strings.Join(f.Values, "/") }
+
+func (f *TextFrame) encode(version byte) ([]byte, error) {
+	values := f.Values
+	if version < 4 && len(values) > 1 {
+		// multiple values are only supported by ID3v2.4
+		values = []string{f.Text()}
+	}
+	enc := f.Encoding.forVersion(version, values...)
+	b := []byte{byte(enc)}
+	for i, v := range values {
+		if i > 0 {
+			b = append(b, enc.terminator()...)
+		}
+		b = append(b, enc.encode(v)...)
+	}
+	return b, nil
+}
+
+// UserTextFrame represents a user defined text frame TXXX
+type UserTextFrame struct {
+	Encoding    Encoding
+	Description string
+	Value       string
+}
+
+// ID returns the frame id
+func (f *UserTextFrame) ID() string { return "TXXX" }
+
+func (f *UserTextFrame) encode(version byte) ([]byte, error) {
+	enc := f.Encoding.forVersion(version, f.Description, f.Value)
+	b := []byte{byte(enc)}
+	b = append(b, enc.encodeTerminated(f.Description)...)
+	return append(b, enc.encode(f.Value)...), nil
+}
+
+// CommentFrame represents a COMM frame
+//  Unsynchronised lyrics (USLT) frames share the same layout
+//  and are represented by this type too
+type CommentFrame struct {
+	FrameID     string
+	Encoding    Encoding
+	Language    string
+	Description string
+	Text        string
+}
+
+// ID returns the frame id
+func (f *CommentFrame) ID() string { return f.FrameID }
+
+func (f *CommentFrame) encode(version byte) ([]byte, error) {
+	enc := f.Encoding.forVersion(version, f.Description, f.Text)
+	lang := f.Language
+	if len(lang) != 3 {
+		lang = "XXX"
+	}
+	b := append([]byte{byte(enc)}, lang...)
+	b = append(b, enc.encodeTerminated(f.Description)...)
+	return append(b, enc.encode(f.Text)...), nil
+}
+
+// PictureType is an attached picture type
+type PictureType byte
+
+// Some of the picture types, see ID3v2 specification for the full list
+const (
+	PictureOther      PictureType = 0x00
+	PictureFileIcon   PictureType = 0x01
+	PictureFrontCover PictureType = 0x03
+	PictureBackCover  PictureType = 0x04
+	PictureArtist     PictureType = 0x08
+)
+
+// PictureFrame represents an attached picture frame APIC
+type PictureFrame struct {
+	Encoding    Encoding
+	MIMEType    string
+	PictureType PictureType
+	Description string
+	Data        []byte
+}
+
+// ID returns the frame id
+func (f *PictureFrame) ID() string { return "APIC" }
+
+func (f *PictureFrame) encode(version byte) ([]byte, error) {
+	enc := f.Encoding.forVersion(version, f.Description)
+	b := []byte{byte(enc)}
+	b = append(b, EncodingISO88591.encodeTerminated(f.MIMEType)...)
+	b = append(b, byte(f.PictureType))
+	b = append(b, enc.encodeTerminated(f.Description)...)
+	return append(b, f.Data...), nil
+}
+
+// URLFrame represents URL link frames W000-WZZZ except WXXX
+type URLFrame struct {
+	FrameID string
+	URL     string
+}
+
+// ID returns the frame id
+func (f *URLFrame) ID() string { return f.FrameID }
+
+func (f *URLFrame) encode(version byte) ([]byte, error) {
+	return EncodingISO88591.encode(f.URL), nil
+}
+
+// UserURLFrame represents a user defined URL link frame WXXX
+type UserURLFrame struct {
+	Encoding    Encoding
+	Description string
+	URL         string
+}
+
+// ID returns the frame id
+func (f *UserURLFrame) ID() string { return "WXXX" }
+
+func (f *UserURLFrame) encode(version byte) ([]byte, error) {
+	enc := f.Encoding.forVersion(version, f.Description)
+	b := []byte{byte(enc)}
+	b = append(b, enc.encodeTerminated(f.Description)...)
+	return append(b, EncodingISO88591.encode(f.URL)...), nil
+}
+
+// PodcastFrame represents the iTunes podcast flag frame PCST
+//  The frame has no meaningful content, its presence marks a podcast episode
+type PodcastFrame struct{}
+
+// ID returns the frame id
+func (f *PodcastFrame) ID() string { return "PCST" }
+
+func (f *PodcastFrame) encode(version byte) ([]byte, error) {
+	return []byte{0, 0, 0, 0}, nil
+}
+
+// PrivateFrame represents a PRIV frame
+type PrivateFrame struct {
+	Owner string
+	Data  []byte
+}
+
+// ID returns the frame id
+func (f *PrivateFrame) ID() string { return "PRIV" }
+
+func (f *PrivateFrame) encode(version byte) ([]byte, error) {
+	b := EncodingISO88591.encodeTerminated(f.Owner)
+	return append(b, f.Data...), nil
+}
+
+// UniqueFileIDFrame represents a unique file identifier frame UFID
+type UniqueFileIDFrame struct {
+	Owner      string
+	Identifier []byte
+}
+
+// ID returns the frame id
+func (f *UniqueFileIDFrame) ID() string { return "UFID" }
+
+func (f *UniqueFileIDFrame) encode(version byte) ([]byte, error) {
+	if len(f.Identifier) > MaxUFIDSize {
+		return nil, ErrUFIDTooLong
+	}
+	b := EncodingISO88591.encodeTerminated(f.Owner)
+	return append(b, f.Identifier...), nil
+}
+
+// RawFrame holds a frame this package doesn't know how to parse
+//  Data is the frame body after unsynchronisation and decompression
+//  were reversed. Encrypted frames are kept as is.
+type RawFrame struct {
+	FrameID string
+	Data    []byte
+}
+
+// ID returns the frame id
+func (f *RawFrame) ID() string { return f.FrameID }
+
+func (f *RawFrame) encode(version byte) ([]byte, error) {
+	return f.Data, nil
+}
+
+// decodeFrame converts a frame body into a typed frame
+//  malformed frames of known types are returned as raw frames
+func decodeFrame(id string, data []byte) Frame {
+	var f Frame
+	switch {
+	case id == "TXXX":
+		f = decodeUserTextFrame(data)
+	case id[0] == 'T' || id == "WFED":
+		// iTunes writes podcast feed URL as a text frame
+		f = decodeTextFrame(id, data)
+	case id == "WXXX":
+		f = decodeUserURLFrame(data)
+	case id[0] == 'W':
+		f = &URLFrame{FrameID: id, URL: EncodingISO88591.decode(trimNull(data))}
+	case id == "COMM" || id == "USLT":
+		f = decodeCommentFrame(id, data)
+	case id == "APIC":
+		f = decodePictureFrame(data)
+	case id == "PCST":
+		f = &PodcastFrame{}
+	case id == "PRIV":
+		owner, rest := EncodingISO88591.split(data)
+		if rest != nil {
+			f = &PrivateFrame{Owner: string(owner), Data: rest}
+		}
+	case id == "UFID":
+		owner, rest := EncodingISO88591.split(data)
+		if rest != nil {
+			f = &UniqueFileIDFrame{Owner: string(owner), Identifier: rest}
+		}
+	}
+	if f == nil {
+		f = &RawFrame{FrameID: id, Data: data}
+	}
+	return f
+}
+
+func decodeTextFrame(id string, data []byte) Frame {
+	if len(data) < 1 {
+		return nil
+	}
+	enc := Encoding(data[0])
+	return &TextFrame{FrameID: id, Encoding: enc, Values: enc.decodeStrings(data[1:])}
+}
+
+func decodeUserTextFrame(data []byte) Frame {
+	if len(data) < 1 {
+		return nil
+	}
+	enc := Encoding(data[0])
+	desc, value := enc.split(data[1:])
+	return &UserTextFrame{
+		Encoding:    enc,
+		Description: enc.decode(desc),
+		Value:       strings.Join(enc.decodeStrings(value), "/"),
+	}
+}
+
+func decodeUserURLFrame(data []byte) Frame {
+	if len(data) < 1 {
+		return nil
+	}
+	enc := Encoding(data[0])
+	desc, url := enc.split(data[1:])
+	return &UserURLFrame{
+		Encoding:    enc,
+		Description: enc.decode(desc),
+		URL:         EncodingISO88591.decode(trimNull(url)),
+	}
+}
+
+func decodeCommentFrame(id string, data []byte) Frame {
+	if len(data) < 4 {
+		return nil
+	}
+	enc := Encoding(data[0])
+	desc, text := enc.split(data[4:])
+	return &CommentFrame{
+		FrameID:     id,
+		Encoding:    enc,
+		Language:    string(data[1:4]),
+		Description: enc.decode(desc),
+		Text:        strings.Join(enc.decodeStrings(text), "\n"),
+	}
+}
+
+func decodePictureFrame(data []byte) Frame {
+	if len(data) < 1 {
+		return nil
+	}
+	enc := Encoding(data[0])
+	mime, rest := EncodingISO88591.split(data[1:])
+	if len(rest) < 1 {
+		return nil
+	}
+	return decodePictureData(enc, string(mime), rest)
+}
+
+// decodePicturePIC decodes an ID3v2.2 PIC frame with a three-character image format
+func decodePicturePIC(data []byte) Frame {
+	if len(data) < 5 {
+		return nil
+	}
+	var mime string
+	switch format := strings.ToUpper(string(data[1:4])); format {
+	case "JPG":
+		mime = "image/jpeg"
+	case "-->":
+		mime = "-->"
+	default:
+		mime = "image/" + strings.ToLower(format)
+	}
+	return decodePictureData(Encoding(data[0]), mime, data[4:])
+}
+
+func decodePictureData(enc Encoding, mime string, data []byte) Frame {
+	desc, picture := enc.split(data[1:])
+	if picture == nil {
+		return nil
+	}
+	return &PictureFrame{
+		Encoding:    enc,
+		MIMEType:    mime,
+		PictureType: PictureType(data[0]),
+		Description: enc.decode(desc),
+		Data:        picture,
+	}
+}
+
+func trimNull(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
@@ -0,0 +1,179 @@
+// Package id3 implements reading of ID3v1, ID3v1.1 and ID3v2.2/2.3/2.4 tags
+package id3
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Errors returned by tag readers
+var (
+	ErrNoTag              = errors.New("id3: no tag found")
+	ErrUnsupportedVersion = errors.New("id3: unsupported tag version")
+	ErrInvalidHeader      = errors.New("id3: invalid tag header")
+	ErrCompressedTag      = errors.New("id3: compressed ID3v2.2 tags are not supported")
+)
+
+// Tag holds all the ID3 tags found in a file
+//  Either of V1 and V2 may be nil but not both
+type Tag struct {
+	V1 *V1
+	V2 *V2
+}
+
+// Read reads ID3 tags from r
+//  ID3v2 tag is looked up at the beginning of the stream and,
+//  if it's not there, right before the ID3v1 tag or the end of the stream
+//  in case it's an appended ID3v2.4 tag with a footer.
+//  ID3v1 tag is looked up in the last 128 bytes of the stream.
+func Read(r io.ReadSeeker) (*Tag, error) {
+	var err error
+	tag := new(Tag)
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	tag.V2, err = ReadV2(r)
+	if err != nil && err != ErrNoTag && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	tag.V1, err = ReadV1(r)
+	if err != nil && err != ErrNoTag {
+		return nil, err
+	}
+
+	if tag.V2 == nil {
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if tag.V1 != nil {
+			end -= v1TagSize
+		}
+		tag.V2, err = readV2Appended(r, end)
+		if err != nil && err != ErrNoTag {
+			return nil, err
+		}
+	}
+
+	if tag.V1 == nil && tag.V2 == nil {
+		return nil, ErrNoTag
+	}
+	return tag, nil
+}
+
+// Title returns the title preferring ID3v2 data over ID3v1
+func (t *Tag) Title() string {
+	return t.text("TIT2", func(v *V1) string { return v.Title })
+}
+
+// Artist returns the artist preferring ID3v2 data over ID3v1
+func (t *Tag) Artist() string {
+	return t.text("TPE1", func(v *V1) string { return v.Artist })
+}
+
+// Album returns the album preferring ID3v2 data over ID3v1
+func (t *Tag) Album() string {
+	return t.text("TALB", func(v *V1) string { return v.Album })
+}
+
+// Year returns the year preferring ID3v2 data over ID3v1
+//  Both TYER (ID3v2.3) and TDRC (ID3v2.4) frames are checked
+func (t *Tag) Year() string {
+	if t.V2 != nil {
+		for _, id := range []string{"TDRC", "TYER"} {
+			if year := t.V2.Text(id); year != "" {
+				if len(year) > 4 {
+					year = year[:4]
+				}
+				return year
+			}
+		}
+	}
+	if t.V1 != nil {
+		return t.V1.Year
+	}
+	return ""
+}
+
+// Comment returns the first comment preferring ID3v2 data over ID3v1
+func (t *Tag) Comment() string {
+	if t.V2 != nil {
+		for _, f := range t.V2.FramesByID("COMM") {
+			if c, ok := f.(*CommentFrame); ok {
+				return c.Text
+			}
+		}
+	}
+	if t.V1 != nil {
+		return t.V1.Comment
+	}
+	return ""
+}
+
+// Track returns the track number preferring ID3v2 data over ID3v1
+//  0 is returned if the track number is not set
+func (t *Tag) Track() int {
+	if t.V2 != nil {
+		if trck := t.V2.Text("TRCK"); trck != "" {
+			if i := strings.IndexByte(trck, '/'); i >= 0 {
+				trck = trck[:i]
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(trck))
+			return n
+		}
+	}
+	if t.V1 != nil {
+		return t.V1.Track
+	}
+	return 0
+}
+
+// Genre returns the genre name preferring ID3v2 data over ID3v1
+//  Numeric ID3v2 genre references like "(13)" are resolved to names
+func (t *Tag) Genre() string {
+	if t.V2 != nil {
+		if tcon := t.V2.Text("TCON"); tcon != "" {
+			return resolveGenre(tcon)
+		}
+	}
+	if t.V1 != nil {
+		return t.V1.GenreName()
+	}
+	return ""
+}
+
+func (t *Tag) text(id string, v1 func(*V1) string) string {
+	if t.V2 != nil {
+		if value := t.V2.Text(id); value != "" {
+			return value
+		}
+	}
+	if t.V1 != nil {
+		return v1(t.V1)
+	}
+	return ""
+}
+
+// resolveGenre turns "(13)", "(13)Pop" and "13" TCON values into genre names
+func resolveGenre(tcon string) string {
+	if strings.HasPrefix(tcon, "(") {
+		end := strings.IndexByte(tcon, ')')
+		if end > 0 {
+			if end < len(tcon)-1 {
+				// refinement follows the reference
+				return tcon[end+1:]
+			}
+			tcon = tcon[1:end]
+		}
+	}
+	if id, err := strconv.Atoi(tcon); err == nil {
+		if name := GenreName(id); name != "" {
+			return name
+		}
+	}
+	return tcon
+}
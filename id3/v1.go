@@ -0,0 +1,96 @@
+package id3
+
+import (
+	"bytes"
+	"io"
+)
+
+const (
+	v1TagSize      = 128
+	v1GenreUnknown = 255
+)
+
+// V1 represents an ID3v1 or ID3v1.1 tag
+type V1 struct {
+	Title   string
+	Artist  string
+	Album   string
+	Year    string
+	Comment string
+	// Track is set for ID3v1.1 tags only, 0 means no track number
+	Track int
+	// Genre is an index in the genre list, 255 means unknown
+	Genre byte
+}
+
+// NewV1 creates an empty ID3v1 tag with unknown genre
+func NewV1() *V1 {
+	return &V1{Genre: v1GenreUnknown}
+}
+
+// ReadV1 reads an ID3v1 tag from the last 128 bytes of r
+func ReadV1(r io.ReadSeeker) (*V1, error) {
+	if _, err := r.Seek(-v1TagSize, io.SeekEnd); err != nil {
+		// stream is shorter than a tag
+		return nil, ErrNoTag
+	}
+	data := make([]byte, v1TagSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return parseV1(data)
+}
+
+func parseV1(data []byte) (*V1, error) {
+	if len(data) != v1TagSize || string(data[:3]) != "TAG" {
+		return nil, ErrNoTag
+	}
+	t := &V1{
+		Title:  v1String(data[3:33]),
+		Artist: v1String(data[33:63]),
+		Album:  v1String(data[63:93]),
+		Year:   v1String(data[93:97]),
+		Genre:  data[127],
+	}
+	comment := data[97:127]
+	if comment[28] == 0 && comment[29] != 0 {
+		// ID3v1.1
+		t.Track = int(comment[29])
+		comment = comment[:28]
+	}
+	t.Comment = v1String(comment)
+	return t, nil
+}
+
+// Bytes encodes the tag
+//  Values are converted to latin1 and truncated to the field sizes,
+//  an ID3v1.1 tag is produced if Track is set
+func (t *V1) Bytes() []byte {
+	data := make([]byte, v1TagSize)
+	copy(data, "TAG")
+	copy(data[3:33], utf8ToLatin1(t.Title))
+	copy(data[33:63], utf8ToLatin1(t.Artist))
+	copy(data[63:93], utf8ToLatin1(t.Album))
+	copy(data[93:97], utf8ToLatin1(t.Year))
+	if t.Track > 0 && t.Track < 256 {
+		copy(data[97:125], utf8ToLatin1(t.Comment))
+		data[126] = byte(t.Track)
+	} else {
+		copy(data[97:127], utf8ToLatin1(t.Comment))
+	}
+	data[127] = t.Genre
+	return data
+}
+
+// GenreName returns the genre name or an empty string if genre is unknown
+func (t *V1) GenreName() string {
+	return GenreName(int(t.Genre))
+}
+
+// v1String decodes a latin1 field trimming the null and space padding
+func v1String(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(latin1ToUTF8(bytes.TrimRight(b, " ")))
+}
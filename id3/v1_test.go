@@ -0,0 +1,72 @@
+package id3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func v1Fixture(title, comment string, track, genre byte) []byte {
+	data := make([]byte, v1TagSize)
+	copy(data, "TAG")
+	copy(data[3:33], title)
+	copy(data[33:63], "Artist")
+	copy(data[63:93], "Album")
+	copy(data[93:97], "1999")
+	copy(data[97:127], comment)
+	if track > 0 {
+		data[125] = 0
+		data[126] = track
+	}
+	data[127] = genre
+	return data
+}
+
+func TestReadV1(t *testing.T) {
+	data := append([]byte("some audio data"), v1Fixture("Super Song", "Nice", 0, 17)...)
+	tag, err := ReadV1(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Title != "Super Song" {
+		t.Errorf("title is %q, expected %q", tag.Title, "Super Song")
+	}
+	if tag.Year != "1999" {
+		t.Errorf("year is %q, expected %q", tag.Year, "1999")
+	}
+	if tag.Comment != "Nice" {
+		t.Errorf("comment is %q, expected %q", tag.Comment, "Nice")
+	}
+	if tag.Track != 0 {
+		t.Errorf("track is %d, expected no track", tag.Track)
+	}
+	if tag.GenreName() != "Rock" {
+		t.Errorf("genre is %q, expected Rock", tag.GenreName())
+	}
+}
+
+func TestReadV11(t *testing.T) {
+	tag, err := ReadV1(bytes.NewReader(v1Fixture("Caf\xe9", "Nice", 7, 255)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Title != "Café" {
+		t.Errorf("title is %q, expected latin1 decoded %q", tag.Title, "Café")
+	}
+	if tag.Track != 7 {
+		t.Errorf("track is %d, expected 7", tag.Track)
+	}
+	if tag.GenreName() != "" {
+		t.Errorf("genre is %q, expected none", tag.GenreName())
+	}
+}
+
+func TestReadV1NoTag(t *testing.T) {
+	_, err := ReadV1(bytes.NewReader(make([]byte, 200)))
+	if err != ErrNoTag {
+		t.Errorf("expected ErrNoTag, got %v", err)
+	}
+	_, err = ReadV1(bytes.NewReader([]byte("short")))
+	if err != ErrNoTag {
+		t.Errorf("expected ErrNoTag on a short stream, got %v", err)
+	}
+}
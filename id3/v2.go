@@ -0,0 +1,504 @@
+package id3
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	v2HeaderSize = 10
+	v2FooterSize = 10
+	maxSynchsafe = 1<<28 - 1
+	defaultV2Ver = 3
+	latestV2Ver  = 4
+)
+
+// MaxFrameSize is the maximum size of a frame body
+const MaxFrameSize = maxSynchsafe
+
+// ErrTagTooLarge is returned on encoding an ID3v2 tag which size doesn't fit into 28 bits
+var ErrTagTooLarge = errors.New("id3: tag is too large")
+
+// ID3v2 header flags
+const (
+	FlagUnsynchronisation = 0x80
+	FlagExtendedHeader    = 0x40
+	FlagExperimental      = 0x20
+	FlagFooter            = 0x10 /* ID3v2.4 only */
+
+	flagCompressionV22 = 0x40
+)
+
+// ID3v2.3 frame format flags
+const (
+	frameFlagCompressionV23 = 0x80
+	frameFlagEncryptionV23  = 0x40
+	frameFlagGroupingV23    = 0x20
+)
+
+// ID3v2.4 frame format flags
+const (
+	frameFlagGroupingV24          = 0x40
+	frameFlagCompressionV24       = 0x08
+	frameFlagEncryptionV24        = 0x04
+	frameFlagUnsynchronisationV24 = 0x02
+	frameFlagDataLengthV24        = 0x01
+)
+
+// V2 represents an ID3v2 tag
+type V2 struct {
+	// Version is the major version: 2, 3 or 4
+	Version  byte
+	Revision byte
+	Flags    byte
+	// Size is the total size of the tag including header and footer
+	Size int
+	// Padding is the size of padding after the last frame
+	Padding int
+	Frames  []Frame
+}
+
+// ReadV2 reads an ID3v2 tag from the current position of r
+func ReadV2(r io.Reader) (*V2, error) {
+	header := make([]byte, v2HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:3]) != "ID3" {
+		return nil, ErrNoTag
+	}
+
+	t := &V2{Version: header[3], Revision: header[4], Flags: header[5]}
+	if t.Version < 2 || t.Version > 4 {
+		return nil, ErrUnsupportedVersion
+	}
+	size, ok := synchsafe(header[6:10])
+	if !ok {
+		return nil, ErrInvalidHeader
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	t.Size = v2HeaderSize + size
+
+	if t.Version == 4 && t.Flags&FlagFooter != 0 {
+		footer := make([]byte, v2FooterSize)
+		if _, err := io.ReadFull(r, footer); err != nil {
+			return nil, err
+		}
+		if string(footer[:3]) != "3DI" {
+			return nil, ErrInvalidHeader
+		}
+		t.Size += v2FooterSize
+	}
+
+	if err := t.parse(body); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// readV2Appended reads an ID3v2.4 tag with a footer ending at offset end
+func readV2Appended(r io.ReadSeeker, end int64) (*V2, error) {
+	start, err := appendedV2Start(r, end)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return ReadV2(r)
+}
+
+// appendedV2Start returns the offset of an ID3v2.4 tag with a footer ending at offset end
+func appendedV2Start(r io.ReadSeeker, end int64) (int64, error) {
+	if end < v2HeaderSize+v2FooterSize {
+		return 0, ErrNoTag
+	}
+	if _, err := r.Seek(end-v2FooterSize, io.SeekStart); err != nil {
+		return 0, err
+	}
+	footer := make([]byte, v2FooterSize)
+	if _, err := io.ReadFull(r, footer); err != nil {
+		return 0, err
+	}
+	if string(footer[:3]) != "3DI" {
+		return 0, ErrNoTag
+	}
+	size, ok := synchsafe(footer[6:10])
+	if !ok {
+		return 0, ErrInvalidHeader
+	}
+	start := end - v2FooterSize - int64(size) - v2HeaderSize
+	if start < 0 {
+		return 0, ErrInvalidHeader
+	}
+	return start, nil
+}
+
+// Frame returns the first frame with the given id or nil
+func (t *V2) Frame(id string) Frame {
+	for _, f := range t.Frames {
+		if f.ID() == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// FramesByID returns all the frames with the given id
+func (t *V2) FramesByID(id string) []Frame {
+	var frames []Frame
+	for _, f := range t.Frames {
+		if f.ID() == id {
+			frames = append(frames, f)
+		}
+	}
+	return frames
+}
+
+// Text returns the value of a text information frame
+//  or an empty string if there's no such frame
+func (t *V2) Text(id string) string {
+	if f, ok := t.Frame(id).(*TextFrame); ok {
+		return f.Text()
+	}
+	return ""
+}
+
+// UserText returns the value of a TXXX frame with the given description
+func (t *V2) UserText(description string) (string, bool) {
+	for _, f := range t.FramesByID("TXXX") {
+		if txxx, ok := f.(*UserTextFrame); ok && txxx.Description == description {
+			return txxx.Value, true
+		}
+	}
+	return "", false
+}
+
+// Private returns the data of a PRIV frame with the given owner
+func (t *V2) Private(owner string) ([]byte, bool) {
+	for _, f := range t.FramesByID("PRIV") {
+		if priv, ok := f.(*PrivateFrame); ok && priv.Owner == owner {
+			return priv.Data, true
+		}
+	}
+	return nil, false
+}
+
+// UniqueFileID returns the identifier of a UFID frame with the given owner
+func (t *V2) UniqueFileID(owner string) ([]byte, bool) {
+	for _, f := range t.FramesByID("UFID") {
+		if ufid, ok := f.(*UniqueFileIDFrame); ok && ufid.Owner == owner {
+			return ufid.Identifier, true
+		}
+	}
+	return nil, false
+}
+
+// SetText replaces the values of a text information frame
+//  The frame is added if it doesn't exist and removed if no values are given
+func (t *V2) SetText(id string, values ...string) {
+	if len(values) == 0 {
+		t.RemoveFrames(id)
+		return
+	}
+	if f, ok := t.Frame(id).(*TextFrame); ok {
+		f.Values = values
+		return
+	}
+	t.Frames = append(t.Frames, &TextFrame{FrameID: id, Values: values})
+}
+
+// RemoveFrames removes all the frames with the given id
+func (t *V2) RemoveFrames(id string) {
+	frames := t.Frames[:0]
+	for _, f := range t.Frames {
+		if f.ID() != id {
+			frames = append(frames, f)
+		}
+	}
+	t.Frames = frames
+}
+
+// Bytes encodes the tag
+//  Tags of versions below 3 are written as ID3v2.3.
+//  Unsynchronisation and extended header are never written,
+//  footer is written for ID3v2.4 tags having FlagFooter set and no padding.
+func (t *V2) Bytes() ([]byte, error) {
+	version := t.Version
+	if version < defaultV2Ver {
+		version = defaultV2Ver
+	}
+	if version > latestV2Ver {
+		return nil, ErrUnsupportedVersion
+	}
+	footer := version == 4 && t.Flags&FlagFooter != 0 && t.Padding == 0
+
+	buf, err := appendFrames(make([]byte, v2HeaderSize), t.Frames, version)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, make([]byte, t.Padding)...)
+
+	size := len(buf) - v2HeaderSize
+	if size > maxSynchsafe {
+		return nil, ErrTagTooLarge
+	}
+	var flags byte
+	if footer {
+		flags |= FlagFooter
+	}
+	header := appendSynchsafe([]byte{'I', 'D', '3', version, 0, flags}, size)
+	copy(buf, header)
+	if footer {
+		header[0], header[1], header[2] = '3', 'D', 'I'
+		buf = append(buf, header...)
+	}
+	return buf, nil
+}
+
+// appendFrames encodes frames with their headers and appends them to buf
+func appendFrames(buf []byte, frames []Frame, version byte) ([]byte, error) {
+	for _, f := range frames {
+		id := f.ID()
+		if len(id) != 4 {
+			return nil, fmt.Errorf("id3: can't write frame %q to ID3v2.%d tag", id, version)
+		}
+		data, err := f.encode(version)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > MaxFrameSize {
+			return nil, ErrTagTooLarge
+		}
+		buf = append(buf, id...)
+		if version == 3 {
+			buf = append(buf, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(buf[len(buf)-4:], uint32(len(data)))
+		} else {
+			buf = appendSynchsafe(buf, len(data))
+		}
+		buf = append(buf, 0, 0)
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+func (t *V2) parse(body []byte) error {
+	if t.Version == 2 && t.Flags&flagCompressionV22 != 0 {
+		return ErrCompressedTag
+	}
+	if t.Version < 4 && t.Flags&FlagUnsynchronisation != 0 {
+		body = removeUnsynchronisation(body)
+	}
+
+	if t.Version > 2 && t.Flags&FlagExtendedHeader != 0 {
+		if len(body) < 4 {
+			return ErrInvalidHeader
+		}
+		var size int
+		if t.Version == 3 {
+			// ID3v2.3 extended header size doesn't include the size field itself
+			size = int(binary.BigEndian.Uint32(body)) + 4
+		} else {
+			var ok bool
+			if size, ok = synchsafe(body[:4]); !ok {
+				return ErrInvalidHeader
+			}
+		}
+		if size > len(body) {
+			return ErrInvalidHeader
+		}
+		body = body[size:]
+	}
+
+	frames, padding, err := t.parseFrames(body)
+	if err != nil {
+		return err
+	}
+	t.Frames = frames
+	t.Padding = len(padding)
+	return nil
+}
+
+// parseFrames decodes the frames found in body
+//  The bytes left after the last frame are returned as padding
+func (t *V2) parseFrames(body []byte) (frames []Frame, padding []byte, err error) {
+	hsize := t.frameHeaderSize()
+	for len(body) >= hsize && body[0] != 0 {
+		id, size, flags := t.frameHeader(body)
+		body = body[hsize:]
+		if size > len(body) {
+			return nil, nil, ErrInvalidHeader
+		}
+		frames = append(frames, t.decodeFrame(id, flags, body[:size]))
+		body = body[size:]
+	}
+	return frames, body, nil
+}
+
+func (t *V2) frameHeaderSize() int {
+	if t.Version == 2 {
+		return 6
+	}
+	return 10
+}
+
+func (t *V2) frameHeader(b []byte) (id string, size int, flags uint16) {
+	switch t.Version {
+	case 2:
+		id = string(b[:3])
+		size = int(b[3])<<16 | int(b[4])<<8 | int(b[5])
+	case 3:
+		id = string(b[:4])
+		size = int(binary.BigEndian.Uint32(b[4:8]))
+		flags = binary.BigEndian.Uint16(b[8:10])
+	default:
+		id = string(b[:4])
+		var ok bool
+		if size, ok = synchsafe(b[4:8]); !ok {
+			// some writers put a plain integer here
+			size = int(binary.BigEndian.Uint32(b[4:8]))
+		}
+		flags = binary.BigEndian.Uint16(b[8:10])
+	}
+	return
+}
+
+func (t *V2) decodeFrame(id string, flags uint16, data []byte) Frame {
+	var compressed, encrypted bool
+	format := byte(flags)
+
+	switch t.Version {
+	case 2:
+		if id == "PIC" {
+			if f := decodePicturePIC(data); f != nil {
+				return f
+			}
+		}
+		if v23, found := v22FrameIDs[id]; found {
+			id = v23
+		}
+	case 3:
+		compressed = format&frameFlagCompressionV23 != 0
+		encrypted = format&frameFlagEncryptionV23 != 0
+		if compressed {
+			// decompressed size
+			data = skip(data, 4)
+		}
+		if encrypted {
+			// encryption method
+			data = skip(data, 1)
+		}
+		if format&frameFlagGroupingV23 != 0 {
+			data = skip(data, 1)
+		}
+	case 4:
+		compressed = format&frameFlagCompressionV24 != 0
+		encrypted = format&frameFlagEncryptionV24 != 0
+		if format&frameFlagGroupingV24 != 0 {
+			data = skip(data, 1)
+		}
+		if encrypted {
+			data = skip(data, 1)
+		}
+		if format&frameFlagDataLengthV24 != 0 {
+			data = skip(data, 4)
+		}
+		if format&frameFlagUnsynchronisationV24 != 0 || t.Flags&FlagUnsynchronisation != 0 {
+			data = removeUnsynchronisation(data)
+		}
+	}
+
+	if encrypted {
+		return &RawFrame{FrameID: id, Data: data}
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return &RawFrame{FrameID: id, Data: data}
+		}
+		decompressed, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return &RawFrame{FrameID: id, Data: data}
+		}
+		data = decompressed
+	}
+
+	var f Frame
+	switch id {
+	case "CHAP":
+		f = t.decodeChapterFrame(data)
+	case "CTOC":
+		f = t.decodeTOCFrame(data)
+	default:
+		return decodeFrame(id, data)
+	}
+	if f == nil {
+		f = &RawFrame{FrameID: id, Data: data}
+	}
+	return f
+}
+
+func skip(data []byte, n int) []byte {
+	if len(data) < n {
+		return nil
+	}
+	return data[n:]
+}
+
+// synchsafe decodes a 28-bit synchsafe integer
+func synchsafe(b []byte) (int, bool) {
+	var n int
+	for _, c := range b {
+		if c&0x80 != 0 {
+			return 0, false
+		}
+		n = n<<7 | int(c)
+	}
+	return n, true
+}
+
+func appendSynchsafe(b []byte, n int) []byte {
+	return append(b, byte(n>>21)&0x7f, byte(n>>14)&0x7f, byte(n>>7)&0x7f, byte(n)&0x7f)
+}
+
+// removeUnsynchronisation reverts 0xff 0x00 -> 0xff
+func removeUnsynchronisation(b []byte) []byte {
+	if bytes.IndexByte(b, 0xff) < 0 {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// v22FrameIDs maps ID3v2.2 frame ids to their ID3v2.3 equivalents
+var v22FrameIDs = map[string]string{
+	"BUF": "RBUF", "CNT": "PCNT", "COM": "COMM", "CRA": "AENC", "ETC": "ETCO",
+	"GEO": "GEOB", "IPL": "IPLS", "LNK": "LINK", "MCI": "MCDI", "MLL": "MLLT",
+	"POP": "POPM", "REV": "RVRB", "SLT": "SYLT", "STC": "SYTC", "UFI": "UFID",
+	"ULT": "USLT", "TAL": "TALB", "TBP": "TBPM", "TCM": "TCOM", "TCO": "TCON",
+	"TCR": "TCOP", "TDA": "TDAT", "TDY": "TDLY", "TEN": "TENC", "TFT": "TFLT",
+	"TIM": "TIME", "TKE": "TKEY", "TLA": "TLAN", "TLE": "TLEN", "TMT": "TMED",
+	"TOA": "TOPE", "TOF": "TOFN", "TOL": "TOLY", "TOR": "TORY", "TOT": "TOAL",
+	"TP1": "TPE1", "TP2": "TPE2", "TP3": "TPE3", "TP4": "TPE4", "TPA": "TPOS",
+	"TPB": "TPUB", "TRC": "TSRC", "TRD": "TRDA", "TRK": "TRCK", "TSI": "TSIZ",
+	"TSS": "TSSE", "TT1": "TIT1", "TT2": "TIT2", "TT3": "TIT3", "TXT": "TEXT",
+	"TXX": "TXXX", "TYE": "TYER", "TCP": "TCMP", "TST": "TSOT", "TSP": "TSOP",
+	"TSA": "TSOA", "TS2": "TSO2", "TSC": "TSOC", "WAF": "WOAF", "WAR": "WOAR",
+	"WAS": "WOAS", "WCM": "WCOM", "WCP": "WCOP", "WPB": "WPUB", "WXX": "WXXX",
+}
@@ -0,0 +1,279 @@
+package id3
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func synchsafeBytes(n int) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
+
+func v2Fixture(version, flags byte, body []byte) []byte {
+	data := []byte{'I', 'D', '3', version, 0, flags}
+	data = append(data, synchsafeBytes(len(body))...)
+	data = append(data, body...)
+	if flags&FlagFooter != 0 {
+		data = append(data, '3', 'D', 'I', version, 0, flags)
+		data = append(data, synchsafeBytes(len(body))...)
+	}
+	return data
+}
+
+func frameFixture(version byte, id string, flags uint16, body []byte) []byte {
+	data := []byte(id)
+	switch version {
+	case 2:
+		data = append(data, byte(len(body)>>16), byte(len(body)>>8), byte(len(body)))
+		return append(data, body...)
+	case 3:
+		data = append(data, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[4:], uint32(len(body)))
+	default:
+		data = append(data, synchsafeBytes(len(body))...)
+	}
+	data = append(data, byte(flags>>8), byte(flags))
+	return append(data, body...)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestReadV23(t *testing.T) {
+	utf16Artist := []byte{1, 0xff, 0xfe, 'A', 0, 0x16, 0x04, 0, 0}
+	body := concat(
+		frameFixture(3, "TIT2", 0, []byte("\x00Super Song")),
+		frameFixture(3, "TPE1", 0, utf16Artist),
+		frameFixture(3, "COMM", 0, []byte("\x00engdesc\x00Nice one")),
+		frameFixture(3, "TXXX", 0, []byte("\x00MusicBrainz Album Id\x00abc-123")),
+		frameFixture(3, "APIC", 0, []byte("\x00image/png\x00\x03cover\x00\x89PNG")),
+		frameFixture(3, "WXXX", 0, []byte("\x00home\x00http://example.com")),
+		frameFixture(3, "XYZW", 0, []byte{1, 2, 3}),
+		make([]byte, 64),
+	)
+	tag, err := ReadV2(bytes.NewReader(v2Fixture(3, 0, body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag.Version != 3 {
+		t.Errorf("version is %d, expected 3", tag.Version)
+	}
+	if tag.Padding != 64 {
+		t.Errorf("padding is %d, expected 64", tag.Padding)
+	}
+	if tag.Size != len(body)+v2HeaderSize {
+		t.Errorf("size is %d, expected %d", tag.Size, len(body)+v2HeaderSize)
+	}
+	if title := tag.Text("TIT2"); title != "Super Song" {
+		t.Errorf("title is %q", title)
+	}
+	if artist := tag.Text("TPE1"); artist != "AЖ" {
+		t.Errorf("UTF-16 artist is %q, expected %q", artist, "AЖ")
+	}
+
+	comm, ok := tag.Frame("COMM").(*CommentFrame)
+	if !ok {
+		t.Fatal("COMM frame not found")
+	}
+	if comm.Language != "eng" || comm.Description != "desc" || comm.Text != "Nice one" {
+		t.Errorf("unexpected comment %+v", comm)
+	}
+
+	if value, ok := tag.UserText("MusicBrainz Album Id"); !ok || value != "abc-123" {
+		t.Errorf("TXXX value is %q", value)
+	}
+
+	apic, ok := tag.Frame("APIC").(*PictureFrame)
+	if !ok {
+		t.Fatal("APIC frame not found")
+	}
+	if apic.MIMEType != "image/png" || apic.PictureType != PictureFrontCover ||
+		apic.Description != "cover" || string(apic.Data) != "\x89PNG" {
+		t.Errorf("unexpected picture %+v", apic)
+	}
+
+	wxxx, ok := tag.Frame("WXXX").(*UserURLFrame)
+	if !ok || wxxx.URL != "http://example.com" || wxxx.Description != "home" {
+		t.Errorf("unexpected WXXX frame %+v", tag.Frame("WXXX"))
+	}
+
+	raw, ok := tag.Frame("XYZW").(*RawFrame)
+	if !ok || !reflect.DeepEqual(raw.Data, []byte{1, 2, 3}) {
+		t.Errorf("unexpected raw frame %+v", tag.Frame("XYZW"))
+	}
+}
+
+func TestReadV23Unsynchronised(t *testing.T) {
+	picture := []byte{0xff, 0xd8, 0xff, 0x00, 0xe0}
+	body := frameFixture(3, "APIC", 0, concat([]byte("\x00image/jpeg\x00\x03\x00"), picture))
+	// apply unsynchronisation to the whole tag
+	unsynced := bytes.Replace(body, []byte{0xff, 0x00}, []byte{0xff, 0x00, 0x00}, -1)
+	unsynced = bytes.Replace(unsynced, []byte{0xff, 0xd8}, []byte{0xff, 0x00, 0xd8}, -1)
+	unsynced = bytes.Replace(unsynced, []byte{0xff, 0xe0}, []byte{0xff, 0x00, 0xe0}, -1)
+
+	tag, err := ReadV2(bytes.NewReader(v2Fixture(3, FlagUnsynchronisation, unsynced)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apic, ok := tag.Frame("APIC").(*PictureFrame)
+	if !ok {
+		t.Fatal("APIC frame not found")
+	}
+	if !bytes.Equal(apic.Data, picture) {
+		t.Errorf("picture data is %x, expected %x", apic.Data, picture)
+	}
+}
+
+func TestReadV23Compressed(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte("\x00Compressed Title"))
+	zw.Close()
+
+	data := concat([]byte{0, 0, 0, 17}, buf.Bytes())
+	body := frameFixture(3, "TIT2", frameFlagCompressionV23, data)
+	tag, err := ReadV2(bytes.NewReader(v2Fixture(3, 0, body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := tag.Text("TIT2"); title != "Compressed Title" {
+		t.Errorf("title is %q", title)
+	}
+}
+
+func TestReadV24(t *testing.T) {
+	extended := concat(synchsafeBytes(6), []byte{1, 0})
+	picture := []byte{0xff, 0x00, 0x01}
+	body := concat(
+		extended,
+		frameFixture(4, "TPE1", 0, []byte("\x03First\x00Second\x00")),
+		frameFixture(4, "TDRC", 0, []byte("\x032020-05-01")),
+		frameFixture(4, "APIC", frameFlagUnsynchronisationV24|frameFlagDataLengthV24,
+			concat(synchsafeBytes(len(picture)+9), []byte("\x00image/x\x00\x00\x00"), []byte{0xff, 0x00, 0x00, 0x01})),
+		frameFixture(4, "PRIV", 0, []byte("com.example\x00\x01\x02")),
+		frameFixture(4, "UFID", 0, []byte("http://musicbrainz.org\x00f00-ba7")),
+		frameFixture(4, "PCST", 0, []byte{0, 0, 0, 0}),
+		frameFixture(4, "WFED", 0, []byte("\x03http://example.com/feed.xml")),
+		frameFixture(4, "WOAS", 0, []byte("http://example.com/episode")),
+	)
+	tag, err := ReadV2(bytes.NewReader(v2Fixture(4, FlagExtendedHeader|FlagFooter, body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Size != len(body)+v2HeaderSize+v2FooterSize {
+		t.Errorf("size is %d, expected %d", tag.Size, len(body)+v2HeaderSize+v2FooterSize)
+	}
+
+	tpe1, ok := tag.Frame("TPE1").(*TextFrame)
+	if !ok {
+		t.Fatal("TPE1 frame not found")
+	}
+	if !reflect.DeepEqual(tpe1.Values, []string{"First", "Second"}) {
+		t.Errorf("TPE1 values are %q", tpe1.Values)
+	}
+
+	apic, ok := tag.Frame("APIC").(*PictureFrame)
+	if !ok {
+		t.Fatal("APIC frame not found")
+	}
+	if !bytes.Equal(apic.Data, picture) {
+		t.Errorf("picture data is %x, expected %x", apic.Data, picture)
+	}
+
+	priv, ok := tag.Frame("PRIV").(*PrivateFrame)
+	if !ok || priv.Owner != "com.example" || !bytes.Equal(priv.Data, []byte{1, 2}) {
+		t.Errorf("unexpected PRIV frame %+v", tag.Frame("PRIV"))
+	}
+	ufid, ok := tag.Frame("UFID").(*UniqueFileIDFrame)
+	if !ok || ufid.Owner != "http://musicbrainz.org" || string(ufid.Identifier) != "f00-ba7" {
+		t.Errorf("unexpected UFID frame %+v", tag.Frame("UFID"))
+	}
+
+	if data, ok := tag.Private("com.example"); !ok || !bytes.Equal(data, []byte{1, 2}) {
+		t.Errorf("private data is %v", data)
+	}
+	if id, ok := tag.UniqueFileID("http://musicbrainz.org"); !ok || string(id) != "f00-ba7" {
+		t.Errorf("unique file id is %q", id)
+	}
+
+	if _, ok := tag.Frame("PCST").(*PodcastFrame); !ok {
+		t.Errorf("unexpected PCST frame %+v", tag.Frame("PCST"))
+	}
+	if feed := tag.Text("WFED"); feed != "http://example.com/feed.xml" {
+		t.Errorf("WFED is %q", feed)
+	}
+	woas, ok := tag.Frame("WOAS").(*URLFrame)
+	if !ok || woas.URL != "http://example.com/episode" {
+		t.Errorf("unexpected WOAS frame %+v", tag.Frame("WOAS"))
+	}
+
+	full := &Tag{V2: tag}
+	if full.Year() != "2020" {
+		t.Errorf("year is %q, expected 2020", full.Year())
+	}
+}
+
+func TestReadV22(t *testing.T) {
+	body := concat(
+		frameFixture(2, "TT2", 0, []byte("\x00Old Song")),
+		frameFixture(2, "TCO", 0, []byte("\x00(17)")),
+		frameFixture(2, "PIC", 0, []byte("\x00JPG\x03\x00\xff\xd8")),
+	)
+	tag, err := ReadV2(bytes.NewReader(v2Fixture(2, 0, body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := tag.Text("TIT2"); title != "Old Song" {
+		t.Errorf("title is %q", title)
+	}
+	apic, ok := tag.Frame("APIC").(*PictureFrame)
+	if !ok || apic.MIMEType != "image/jpeg" || !bytes.Equal(apic.Data, []byte{0xff, 0xd8}) {
+		t.Errorf("unexpected picture %+v", tag.Frame("APIC"))
+	}
+	full := &Tag{V2: tag}
+	if full.Genre() != "Rock" {
+		t.Errorf("genre is %q, expected Rock", full.Genre())
+	}
+}
+
+func TestRead(t *testing.T) {
+	v2 := v2Fixture(3, 0, frameFixture(3, "TIT2", 0, []byte("\x00V2 Title")))
+	v1 := v1Fixture("V1 Title", "", 3, 13)
+	tag, err := Read(bytes.NewReader(concat(v2, []byte("audio"), v1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.V1 == nil || tag.V2 == nil {
+		t.Fatal("both tags are expected to be found")
+	}
+	if tag.Title() != "V2 Title" {
+		t.Errorf("title is %q, expected ID3v2 title", tag.Title())
+	}
+	if tag.Artist() != "Artist" {
+		t.Errorf("artist is %q, expected fallback to ID3v1", tag.Artist())
+	}
+	if tag.Track() != 3 || tag.Genre() != "Pop" {
+		t.Errorf("track %d and genre %q don't match ID3v1 values", tag.Track(), tag.Genre())
+	}
+}
+
+func TestReadAppended(t *testing.T) {
+	v2 := v2Fixture(4, FlagFooter, frameFixture(4, "TIT2", 0, []byte("\x03Appended")))
+	tag, err := Read(bytes.NewReader(concat([]byte("audio"), v2, v1Fixture("V1", "", 0, 0))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.V2 == nil || tag.Title() != "Appended" {
+		t.Errorf("appended tag not found")
+	}
+
+	_, err = Read(bytes.NewReader([]byte("just some audio data")))
+	if err != ErrNoTag {
+		t.Errorf("expected ErrNoTag, got %v", err)
+	}
+}
@@ -1,8 +1,13 @@
 package lame
 
 import (
+	"bytes"
 	"io/ioutil"
 	"testing"
+	"time"
+
+	"github.com/viert/go-lame/ape"
+	"github.com/viert/go-lame/id3"
 )
 
 func TestID3V1(t *testing.T) {
@@ -33,3 +38,233 @@ func TestID3V2(t *testing.T) {
 		t.Error("Song name not found")
 	}
 }
+
+func TestID3V2Read(t *testing.T) {
+	w := ioutil.Discard
+	enc := NewEncoder(w)
+
+	enc.ID3TagAddV2()
+	enc.ID3TagSetTitle("Super Song")
+	enc.ID3TagSetArtist("Super Artist")
+	tag, err := id3.ReadV2(bytes.NewReader(enc.ID3V2Tag()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := tag.Text("TIT2"); title != "Super Song" {
+		t.Errorf("title is %q, expected %q", title, "Super Song")
+	}
+	if artist := tag.Text("TPE1"); artist != "Super Artist" {
+		t.Errorf("artist is %q, expected %q", artist, "Super Artist")
+	}
+}
+
+func TestID3Chapters(t *testing.T) {
+	w := ioutil.Discard
+	enc := NewEncoder(w)
+
+	enc.ID3TagSetTitle("Podcast Episode")
+	enc.AddChapter(Chapter{Title: "Intro", Start: 0, End: 10 * time.Second})
+	enc.AddChapterSamples(Chapter{ID: "main", Title: "Main"}, 441000, 882000)
+	tag, err := id3.ReadV2(bytes.NewReader(enc.ID3V2Tag()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := tag.Text("TIT2"); title != "Podcast Episode" {
+		t.Errorf("title is %q, expected lame generated frames to be kept", title)
+	}
+
+	toc, ok := tag.Frame("CTOC").(*id3.TOCFrame)
+	if !ok {
+		t.Fatal("CTOC frame not found")
+	}
+	if len(toc.ChildElementIDs) != 2 || toc.ChildElementIDs[1] != "main" {
+		t.Errorf("unexpected table of contents %v", toc.ChildElementIDs)
+	}
+
+	chapters := tag.FramesByID("CHAP")
+	if len(chapters) != 2 {
+		t.Fatalf("%d chapters found, expected 2", len(chapters))
+	}
+	// 576 samples of encoder delay at 44100Hz is 13ms
+	main := chapters[1].(*id3.ChapterFrame)
+	if main.Title() != "Main" || main.StartTime != 10013 || main.EndTime != 20013 {
+		t.Errorf("unexpected chapter %s %d-%d", main.Title(), main.StartTime, main.EndTime)
+	}
+}
+
+func TestID3V24(t *testing.T) {
+	w := ioutil.Discard
+	enc := NewEncoder(w)
+
+	if err := enc.SetID3V2Version(2); err == nil {
+		t.Error("ID3v2.2 output is expected to be unsupported")
+	}
+	if err := enc.SetID3V2Version(4); err != nil {
+		t.Fatal(err)
+	}
+	enc.ID3TagSetTitle("Песня")
+	enc.ID3TagSetYear("2020")
+	enc.ID3TagSetGenre("17")
+	tag, err := id3.ReadV2(bytes.NewReader(enc.ID3V2Tag()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Version != 4 {
+		t.Errorf("tag version is %d, expected 4", tag.Version)
+	}
+	title, ok := tag.Frame("TIT2").(*id3.TextFrame)
+	if !ok || title.Encoding != id3.EncodingUTF8 || title.Text() != "Песня" {
+		t.Errorf("unexpected title frame %+v", tag.Frame("TIT2"))
+	}
+	if year := tag.Text("TDRC"); year != "2020" {
+		t.Errorf("TDRC is %q, expected 2020", year)
+	}
+	if genre := tag.Text("TCON"); genre != "Rock" {
+		t.Errorf("TCON is %q, expected Rock", genre)
+	}
+}
+
+func TestID3V24Padding(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	defer enc.Close()
+	enc.SetID3V2Version(4)
+	enc.ID3TagSetTitle("Title")
+	fresh := enc.ID3V2Tag()
+
+	// the same tag is built for the next stream
+	enc.InitID3Tag()
+	enc.ID3TagSetTitle("Title")
+	if next := enc.ID3V2Tag(); !bytes.Equal(fresh, next) {
+		t.Errorf("tag of a new encoder is %d bytes, after InitID3Tag %d bytes", len(fresh), len(next))
+	}
+}
+
+func TestAPETag(t *testing.T) {
+	w := ioutil.Discard
+	enc := NewEncoder(w)
+
+	enc.SetWriteAPETag(true)
+	enc.ID3TagSetTitle("Super Song")
+	enc.APETagSetItem("REPLAYGAIN_TRACK_GAIN", "-6.20 dB")
+	data, err := enc.APETag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := ape.Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title, _ := tag.Text("Title"); title != "Super Song" {
+		t.Errorf("title is %q", title)
+	}
+	if gain, _ := tag.Text("REPLAYGAIN_TRACK_GAIN"); gain != "-6.20 dB" {
+		t.Errorf("replay gain is %q", gain)
+	}
+
+	enc.APETagSetItem("x", "invalid key")
+	if _, err = enc.APETag(); err == nil {
+		t.Error("invalid item key is expected to fail")
+	}
+}
+
+func TestID3Podcast(t *testing.T) {
+	w := ioutil.Discard
+	enc := NewEncoder(w)
+
+	enc.ID3TagSetTitle("Episode 1")
+	enc.ID3TagSetPodcast(true)
+	enc.ID3TagSetPodcastFeedURL("http://example.com/feed.xml")
+	enc.ID3TagSetPodcastID("episode-1")
+	enc.ID3TagSetPodcastDescription("The first one")
+	enc.ID3TagSetPodcastCategory("Technology")
+	enc.ID3TagSetArtistURL("http://example.com/artist")
+	enc.ID3TagSetSourceURL("http://example.com/episode-1")
+	enc.ID3TagSetUserURL("shownotes", "http://example.com/notes")
+	enc.ID3TagSetPodcastCategory("News")
+
+	tag, err := id3.ReadV2(bytes.NewReader(enc.ID3V2Tag()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tag.Frame("PCST").(*id3.PodcastFrame); !ok {
+		t.Error("PCST frame not found")
+	}
+	for id, expected := range map[string]string{
+		"TIT2": "Episode 1",
+		"WFED": "http://example.com/feed.xml",
+		"TGID": "episode-1",
+		"TDES": "The first one",
+		"TCAT": "News",
+	} {
+		if value := tag.Text(id); value != expected {
+			t.Errorf("%s is %q, expected %q", id, value, expected)
+		}
+	}
+	if len(tag.FramesByID("TCAT")) != 1 {
+		t.Error("TCAT frame is expected to be replaced")
+	}
+	if woar, ok := tag.Frame("WOAR").(*id3.URLFrame); !ok || woar.URL != "http://example.com/artist" {
+		t.Errorf("unexpected WOAR frame %+v", tag.Frame("WOAR"))
+	}
+	if wxxx, ok := tag.Frame("WXXX").(*id3.UserURLFrame); !ok || wxxx.Description != "shownotes" {
+		t.Errorf("unexpected WXXX frame %+v", tag.Frame("WXXX"))
+	}
+
+	enc.ID3TagSetPodcast(false)
+	tag, err = id3.ReadV2(bytes.NewReader(enc.ID3V2Tag()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Frame("PCST") != nil {
+		t.Error("PCST frame is expected to be removed")
+	}
+}
+
+func TestID3PrivateFrames(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+
+	enc.ID3TagSetPrivate("com.example.catalog", []byte{0, 1, 2, 3})
+	enc.ID3TagSetPrivate("com.example.other", []byte("other"))
+	err := enc.ID3TagSetUniqueFileID("http://musicbrainz.org", []byte("5b11f4ce-a62d-471e-81fc-a69a8278c7da"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = enc.ID3TagSetUniqueFileID("http://musicbrainz.org", make([]byte, 65))
+	if err != id3.ErrUFIDTooLong {
+		t.Errorf("expected ErrUFIDTooLong, got %v", err)
+	}
+	enc.ID3TagSetPrivate("com.example.other", nil)
+
+	tag, err := id3.ReadV2(bytes.NewReader(enc.ID3V2Tag()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, ok := tag.Private("com.example.catalog")
+	if !ok || !bytes.Equal(data, []byte{0, 1, 2, 3}) {
+		t.Errorf("unexpected PRIV data %v", data)
+	}
+	if _, ok = tag.Private("com.example.other"); ok {
+		t.Error("removed PRIV frame is found")
+	}
+	id, ok := tag.UniqueFileID("http://musicbrainz.org")
+	if !ok || string(id) != "5b11f4ce-a62d-471e-81fc-a69a8278c7da" {
+		t.Errorf("unexpected UFID %q", id)
+	}
+}
+
+func TestID3V2TagError(t *testing.T) {
+	out := new(bytes.Buffer)
+	enc := NewEncoder(out)
+	defer enc.Close()
+	enc.ID3TagSetFrame(&id3.UniqueFileIDFrame{Owner: "http://example.com", Identifier: make([]byte, 100)})
+
+	if enc.ID3V2Tag() != nil {
+		t.Error("the tag which can't be built is expected to be nil")
+	}
+	if _, err := enc.Write(pcmInput(44100)); err != id3.ErrUFIDTooLong {
+		t.Errorf("expected ErrUFIDTooLong on Write, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("%d bytes are written without the tag", out.Len())
+	}
+}
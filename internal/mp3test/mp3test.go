@@ -0,0 +1,48 @@
+// Package mp3test provides the MPEG audio fixtures shared by the tests of
+// the packages consuming encoder output
+package mp3test
+
+import "github.com/viert/go-lame/mp3"
+
+// FrameSize is the size of the frames Stream and Frames return
+const FrameSize = 417
+
+// Delay is the encoder delay the PTS of Frames start from, the one lame has
+const Delay = 576
+
+// header is MPEG1 Layer III 128kbps 44100Hz stereo
+var header = []byte{0xff, 0xfb, 0x90, 0x44}
+
+// frame returns the i-th frame, its last byte is the index
+func frame(i int) []byte {
+	data := make([]byte, FrameSize)
+	copy(data, header)
+	data[FrameSize-1] = byte(i)
+	return data
+}
+
+// Stream returns an ID3 tag followed by the given number of frames
+//  audio is the data without the tag
+func Stream(frames int) (data []byte, audio []byte) {
+	for i := 0; i < frames; i++ {
+		audio = append(audio, frame(i)...)
+	}
+	data = append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 0}, audio...)
+	return data, audio
+}
+
+// Frames returns n frames as the encoder frame handler gets them,
+// 38 of them fit into a second
+func Frames(n int) []mp3.Frame {
+	h, _ := mp3.ParseHeader(header)
+	var frames []mp3.Frame
+	for i := 0; i < n; i++ {
+		frames = append(frames, mp3.Frame{
+			Header: h,
+			Data:   frame(i),
+			Index:  int64(i),
+			PTS:    int64(i*h.Samples() - Delay),
+		})
+	}
+	return frames
+}
@@ -0,0 +1,214 @@
+package lame
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrLadderOutputs is returned if the number of outputs doesn't match the profiles
+	ErrLadderOutputs = errors.New("lame: ladder needs one output per profile")
+	// ErrLadderInput is returned if the profiles expect different PCM input
+	ErrLadderInput = errors.New("lame: ladder profiles differ in input channels or samplerate")
+	// ErrLadderSamplerate is returned if the profiles set different output samplerates
+	ErrLadderSamplerate = errors.New("lame: ladder profiles differ in output samplerate")
+)
+
+// ladderJob is a call made on every encoder of the ladder
+type ladderJob func(i int, enc *Encoder) error
+
+// Ladder encodes the same PCM input into several renditions at once
+//  Every encoder runs in its own goroutine, the input buffer is shared by
+//  all of them read only, so it's not copied. Write returns when every
+//  encoder is done with the input.
+//
+//  Frames of the renditions are aligned: the encoders share the output
+//  samplerate, which is the input one unless a profile sets it, so their
+//  frames have the same duration and the same encoder delay. The bit
+//  reservoir is disabled, so a segmenter cutting at the same frames in
+//  every rendition, e.g. hls.Segmenter with the same target duration,
+//  makes segments which decode on their own and can be switched between.
+//
+//  The renditions can't be kept aligned once an encoder fails, so the first
+//  error of Write or Flush fails the ladder: the calls after it return the
+//  same error without encoding, only Close is left to release the encoders.
+type Ladder struct {
+	mu       sync.Mutex
+	encoders []*Encoder
+	jobs     []chan ladderJob
+	errs     []error
+	wg       sync.WaitGroup
+	closed   bool
+	err      error
+}
+
+// NewLadder creates an encoder per profile writing to the corresponding output
+func NewLadder(profiles []EncoderConfig, outputs []io.Writer) (*Ladder, error) {
+	if len(profiles) != len(outputs) || len(profiles) == 0 {
+		return nil, ErrLadderOutputs
+	}
+
+	outSamplerate := 0
+	for _, cfg := range profiles {
+		if cfg.OutSamplerate == 0 {
+			continue
+		}
+		if outSamplerate != 0 && cfg.OutSamplerate != outSamplerate {
+			return nil, ErrLadderSamplerate
+		}
+		outSamplerate = cfg.OutSamplerate
+	}
+
+	l := &Ladder{}
+	for i, cfg := range profiles {
+		enc := NewEncoder(outputs[i])
+		l.encoders = append(l.encoders, enc)
+		if err := l.configure(enc, cfg, outSamplerate); err != nil {
+			l.closeEncoders()
+			return nil, err
+		}
+	}
+
+	l.jobs = make([]chan ladderJob, len(l.encoders))
+	l.errs = make([]error, len(l.encoders))
+	for i := range l.encoders {
+		l.jobs[i] = make(chan ladderJob)
+		go l.worker(i)
+	}
+	return l, nil
+}
+
+// configure applies a profile checking it takes the same input as the first one
+func (l *Ladder) configure(enc *Encoder, cfg EncoderConfig, outSamplerate int) error {
+	if err := enc.Configure(cfg); err != nil {
+		return err
+	}
+	first := l.encoders[0]
+	if enc.NumChannels() != first.NumChannels() || enc.InSamplerate() != first.InSamplerate() {
+		return ErrLadderInput
+	}
+	if outSamplerate == 0 {
+		// lame would pick the samplerate for the bitrate otherwise
+		outSamplerate = enc.InSamplerate()
+	}
+	if err := enc.SetOutSamplerate(outSamplerate); err != nil {
+		return err
+	}
+	return enc.SetDisableReservoir(true)
+}
+
+// Encoders returns the encoders of the ladder in the profiles order
+//  They may be used to set tags before the first Write,
+//  encoding parameters must not be changed.
+func (l *Ladder) Encoders() []*Encoder {
+	return l.encoders
+}
+
+// Write encodes p with every encoder
+//  It's all or nothing: if any encoder fails, 0 and the first error in the
+//  profiles order are returned and the ladder is failed, as the renditions
+//  which consumed p can't be rewound to retry it.
+func (l *Ladder) Write(p []byte) (int, error) {
+	err := l.run(func(i int, enc *Encoder) error {
+		_, err := enc.Write(p)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ReadFrom reads PCM data from r until EOF encoding it with every encoder
+func (l *Ladder) ReadFrom(r io.Reader) (int64, error) {
+	buf := make([]byte, maxBlockSamples*maxBlockAlignment)
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			written, werr := l.Write(buf[:n])
+			total += int64(written)
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// Flush flushes every encoder
+func (l *Ladder) Flush() error {
+	return l.run(func(i int, enc *Encoder) error {
+		_, err := enc.Flush()
+		return err
+	})
+}
+
+// Close closes every encoder and stops the goroutines
+func (l *Ladder) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	err := l.dispatch(func(i int, enc *Encoder) error {
+		return enc.Close()
+	})
+	l.closed = true
+	for _, jobs := range l.jobs {
+		close(jobs)
+	}
+	return err
+}
+
+// run calls job on every encoder failing the ladder on error
+func (l *Ladder) run(job ladderJob) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrEncoderClosed
+	}
+	if l.err != nil {
+		return l.err
+	}
+	l.err = l.dispatch(job)
+	return l.err
+}
+
+// dispatch calls job on every encoder in parallel waiting for all of them
+//  l.mu is expected to be held
+func (l *Ladder) dispatch(job ladderJob) error {
+	l.wg.Add(len(l.encoders))
+	for _, jobs := range l.jobs {
+		jobs <- job
+	}
+	l.wg.Wait()
+
+	var err error
+	for i := range l.errs {
+		if err == nil {
+			err = l.errs[i]
+		}
+		l.errs[i] = nil
+	}
+	return err
+}
+
+func (l *Ladder) worker(i int) {
+	for job := range l.jobs[i] {
+		l.errs[i] = job(i, l.encoders[i])
+		l.wg.Done()
+	}
+}
+
+func (l *Ladder) closeEncoders() {
+	for _, enc := range l.encoders {
+		enc.Close()
+	}
+}
@@ -0,0 +1,131 @@
+package lame
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/viert/go-lame/mp3"
+)
+
+func TestLadder(t *testing.T) {
+	profiles := []EncoderConfig{{Brate: 64}, {Brate: 128}, {Brate: 320}}
+	pts := make([][]int64, len(profiles))
+	var outputs []io.Writer
+	for i := range profiles {
+		i := i
+		outputs = append(outputs, mp3.NewFrameWriter(func(f mp3.Frame) error {
+			pts[i] = append(pts[i], f.PTS)
+			return nil
+		}))
+	}
+
+	ladder, err := NewLadder(profiles, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, enc := range ladder.Encoders() {
+		if enc.Brate() != profiles[i].Brate || enc.OutSamplerate() != 44100 || !enc.DisableReservoir() {
+			t.Errorf("encoder %d: bitrate %d, samplerate %d, reservoir disabled %v",
+				i, enc.Brate(), enc.OutSamplerate(), enc.DisableReservoir())
+		}
+	}
+
+	input := pcmInput(44100 * 4 * 2)
+	n, err := io.Copy(ladder, bytes.NewReader(input))
+	if err != nil || n != int64(len(input)) {
+		t.Fatalf("copied %d bytes of %d, %v", n, len(input), err)
+	}
+	if err := ladder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ladder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ladder.Close(); err != nil {
+		t.Errorf("second Close returned %v", err)
+	}
+	if _, err := ladder.Write(input); err != ErrEncoderClosed {
+		t.Errorf("expected ErrEncoderClosed writing to a closed ladder, got %v", err)
+	}
+
+	if len(pts[0]) == 0 {
+		t.Fatal("no frames encoded")
+	}
+	for i := 1; i < len(pts); i++ {
+		if len(pts[i]) != len(pts[0]) {
+			t.Errorf("rendition %d has %d frames, expected %d", i, len(pts[i]), len(pts[0]))
+			continue
+		}
+		for j := range pts[i] {
+			if pts[i][j] != pts[0][j] {
+				t.Errorf("rendition %d frame %d PTS is %d, expected %d", i, j, pts[i][j], pts[0][j])
+				break
+			}
+		}
+	}
+}
+
+func TestLadderFailure(t *testing.T) {
+	failure := errors.New("rendition failed")
+	var frames []int
+	outputs := []io.Writer{
+		mp3.NewFrameWriter(func(f mp3.Frame) error {
+			frames = append(frames, int(f.Index))
+			return nil
+		}),
+		mp3.NewFrameWriter(func(f mp3.Frame) error {
+			return failure
+		}),
+	}
+	ladder, err := NewLadder([]EncoderConfig{{Brate: 64}, {Brate: 128}}, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ladder.Close()
+
+	input := pcmInput(44100 * 4)
+	if n, err := ladder.Write(input); n != 0 || err != failure {
+		t.Fatalf("expected nothing written on a rendition failure, got %d, %v", n, err)
+	}
+	encoded := len(frames)
+	if n, err := ladder.Write(input); n != 0 || err != failure {
+		t.Errorf("expected the failed ladder to return the error, got %d, %v", n, err)
+	}
+	if err := ladder.Flush(); err != failure {
+		t.Errorf("expected the failed ladder to return the error on Flush, got %v", err)
+	}
+	if len(frames) != encoded {
+		t.Error("the failed ladder keeps encoding")
+	}
+}
+
+func TestLadderProfiles(t *testing.T) {
+	outputs := []io.Writer{new(bytes.Buffer), new(bytes.Buffer)}
+	tests := []struct {
+		profiles []EncoderConfig
+		err      error
+	}{
+		{[]EncoderConfig{{Brate: 128}}, ErrLadderOutputs},
+		{[]EncoderConfig{{InSamplerate: 48000}, {}}, ErrLadderInput},
+		{[]EncoderConfig{{NumChannels: 1}, {NumChannels: 2}}, ErrLadderInput},
+		{[]EncoderConfig{{OutSamplerate: 22050}, {OutSamplerate: 44100}}, ErrLadderSamplerate},
+	}
+	for _, tt := range tests {
+		if _, err := NewLadder(tt.profiles, outputs); err != tt.err {
+			t.Errorf("%+v: expected %v, got %v", tt.profiles, tt.err, err)
+		}
+	}
+
+	ladder, err := NewLadder([]EncoderConfig{{OutSamplerate: 22050}, {Brate: 64}}, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ladder.Close()
+	for i, enc := range ladder.Encoders() {
+		if enc.OutSamplerate() != 22050 {
+			t.Errorf("encoder %d output samplerate is %d", i, enc.OutSamplerate())
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	id3v2HeaderSize = 10
+	id3v1TagSize    = 128
+	apeHeaderSize   = 32
+)
+
+// Frame is a complete MPEG audio frame
+type Frame struct {
+	Header Header
+	// Data is the whole frame including the header
+	Data []byte
+	// Index is the number of the frame in the stream starting with 0
+	Index int64
+	// PTS is the presentation timestamp of the first sample of the frame
+	// in samples, the encoder delay makes it negative for the first frames
+	PTS int64
+}
+
+// Duration returns the frame duration in samples
+func (f *Frame) Duration() int {
+	return f.Header.Samples()
+}
+
+// Time converts PTS to time
+func (f *Frame) Time() time.Duration {
+	return time.Duration(f.PTS * int64(time.Second) / int64(f.Header.Samplerate))
+}
+
+// FrameWriter splits a stream written into it into frames
+//  ID3v2, ID3v1 and APE tags and Xing/Info frames are skipped,
+//  so are the bytes which don't look like a frame header.
+type FrameWriter struct {
+	// Delay is the encoder delay in samples subtracted from PTS
+	Delay int
+
+	handler func(Frame) error
+	buf     []byte
+	skip    int
+	index   int64
+	pts     int64
+}
+
+// NewFrameWriter creates a FrameWriter calling handler for each frame
+//  Frame data is only valid until handler returns.
+func NewFrameWriter(handler func(Frame) error) *FrameWriter {
+	return &FrameWriter{handler: handler}
+}
+
+// Write implements io.Writer, frames are handed over as soon as they're complete
+//  An error returned by handler is returned as is, the frame is not delivered again.
+func (w *FrameWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if w.skip > 0 {
+		k := w.skip
+		if k > len(p) {
+			k = len(p)
+		}
+		w.skip -= k
+		p = p[k:]
+	}
+	w.buf = append(w.buf, p...)
+
+	var err error
+	pos := 0
+	for err == nil {
+		var consumed int
+		consumed, err = w.next(w.buf[pos:])
+		if consumed == 0 {
+			break
+		}
+		pos += consumed
+	}
+	// keep the incomplete data at the beginning of the buffer
+	w.buf = w.buf[:copy(w.buf, w.buf[pos:])]
+	return n, err
+}
+
+// Reset drops the buffered data and starts counting frames from 0
+func (w *FrameWriter) Reset() {
+	w.buf = w.buf[:0]
+	w.skip = 0
+	w.index = 0
+	w.pts = 0
+}
+
+// next handles the frame or tag at the beginning of b returning
+// the number of bytes consumed, 0 means more data is required
+func (w *FrameWriter) next(b []byte) (int, error) {
+	if size, ok := tagSize(b); ok {
+		if size == 0 {
+			return 0, nil
+		}
+		if size > len(b) {
+			w.skip = size - len(b)
+			return len(b), nil
+		}
+		return size, nil
+	}
+
+	h, err := ParseHeader(b)
+	switch err {
+	case nil:
+	case ErrShortHeader:
+		return 0, nil
+	default:
+		// look for the next sync
+		for i := 1; i < len(b); i++ {
+			if b[i] == 0xff {
+				return i, nil
+			}
+		}
+		return len(b), nil
+	}
+
+	size := h.Size()
+	if size > len(b) {
+		return 0, nil
+	}
+	data := b[:size]
+	if isInfoFrame(h, data) {
+		return size, nil
+	}
+
+	f := Frame{Header: h, Data: data, Index: w.index, PTS: w.pts - int64(w.Delay)}
+	w.index++
+	w.pts += int64(h.Samples())
+	return size, w.handler(f)
+}
+
+// tagSize returns the size of a tag at the beginning of b
+//  0 with ok set means there's not enough data to tell the size
+func tagSize(b []byte) (size int, ok bool) {
+	switch {
+	case hasPrefix(b, "ID3"):
+		if len(b) < id3v2HeaderSize {
+			return 0, true
+		}
+		size = int(b[6])<<21 | int(b[7])<<14 | int(b[8])<<7 | int(b[9])
+		size += id3v2HeaderSize
+		if b[5]&0x10 != 0 {
+			// footer
+			size += id3v2HeaderSize
+		}
+		return size, true
+	case hasPrefix(b, "APETAGEX"):
+		if len(b) < apeHeaderSize {
+			return 0, true
+		}
+		flags := binary.LittleEndian.Uint32(b[20:])
+		if flags&(1<<29) == 0 {
+			// a footer, the items are gone already
+			return apeHeaderSize, true
+		}
+		// the size includes the items and the footer but not the header
+		return int(binary.LittleEndian.Uint32(b[12:])) + apeHeaderSize, true
+	case hasPrefix(b, "TAG"):
+		if len(b) < 3 {
+			return 0, true
+		}
+		return id3v1TagSize, true
+	}
+	return 0, false
+}
+
+// hasPrefix reports whether b starts with prefix, a partial prefix at
+// the end of b counts as a match so that the decision waits for more data
+func hasPrefix(b []byte, prefix string) bool {
+	for i := 0; i < len(prefix); i++ {
+		if i == len(b) {
+			return i > 0
+		}
+		if b[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isInfoFrame reports whether the frame holds a Xing or Info VBR header
+func isInfoFrame(h Header, data []byte) bool {
+	if h.Layer != 3 {
+		return false
+	}
+	offset := HeaderSize + h.SideInfoSize()
+	if h.Protected {
+		offset += 2
+	}
+	if len(data) < offset+4 {
+		return false
+	}
+	tag := string(data[offset : offset+4])
+	return tag == "Xing" || tag == "Info"
+}
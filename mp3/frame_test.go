@@ -0,0 +1,86 @@
+package mp3
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func frameFixture(header []byte, fill byte) []byte {
+	h, _ := ParseHeader(header)
+	data := bytes.Repeat([]byte{fill}, h.Size())
+	copy(data, header)
+	return data
+}
+
+func infoFrameFixture() []byte {
+	data := frameFixture([]byte{0xff, 0xfb, 0x90, 0x44}, 0)
+	copy(data[HeaderSize+32:], "Info")
+	return data
+}
+
+func streamFixture(frames int) []byte {
+	var stream []byte
+	// ID3v2 tag with a 0xff byte inside
+	stream = append(stream, 'I', 'D', '3', 3, 0, 0, 0, 0, 0, 5, 0xff, 0xfb, 0x90, 0x44, 0)
+	stream = append(stream, infoFrameFixture()...)
+	for i := 0; i < frames; i++ {
+		header := []byte{0xff, 0xfb, 0x90, 0x44}
+		if i%2 == 1 {
+			header[2] |= 2 // padding
+		}
+		stream = append(stream, frameFixture(header, byte(i+1))...)
+	}
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	return append(stream, tag...)
+}
+
+func TestFrameWriter(t *testing.T) {
+	stream := streamFixture(10)
+	for _, chunk := range []int{1, 7, 500, len(stream)} {
+		var frames []Frame
+		w := NewFrameWriter(func(f Frame) error {
+			f.Data = append([]byte{}, f.Data...)
+			frames = append(frames, f)
+			return nil
+		})
+		w.Delay = 576
+		for i := 0; i < len(stream); i += chunk {
+			end := i + chunk
+			if end > len(stream) {
+				end = len(stream)
+			}
+			if n, err := w.Write(stream[i:end]); err != nil || n != end-i {
+				t.Fatalf("chunk %d: Write returned %d, %v", chunk, n, err)
+			}
+		}
+
+		if len(frames) != 10 {
+			t.Fatalf("chunk %d: %d frames, expected 10", chunk, len(frames))
+		}
+		for i, f := range frames {
+			if f.Index != int64(i) || f.PTS != int64(i*1152-576) {
+				t.Errorf("chunk %d: frame %d has index %d and PTS %d", chunk, i, f.Index, f.PTS)
+			}
+			if len(f.Data) != f.Header.Size() || f.Data[len(f.Data)-1] != byte(i+1) {
+				t.Errorf("chunk %d: frame %d data doesn't match", chunk, i)
+			}
+		}
+	}
+}
+
+func TestFrameWriterHandlerError(t *testing.T) {
+	errStop := errors.New("stop")
+	calls := 0
+	w := NewFrameWriter(func(f Frame) error {
+		calls++
+		return errStop
+	})
+	if _, err := w.Write(streamFixture(3)); err != errStop {
+		t.Errorf("expected handler error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("handler is called %d times, expected 1", calls)
+	}
+}
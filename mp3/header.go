@@ -0,0 +1,167 @@
+// Package mp3 implements parsing of MPEG audio frame headers and splitting
+// of an MPEG audio stream into frames
+package mp3
+
+import (
+	"errors"
+)
+
+// HeaderSize is the size of an MPEG audio frame header
+const HeaderSize = 4
+
+// Errors returned by ParseHeader
+var (
+	ErrNoSync      = errors.New("mp3: no frame sync")
+	ErrInvalid     = errors.New("mp3: invalid frame header")
+	ErrFreeFormat  = errors.New("mp3: free format bitrate is not supported")
+	ErrShortHeader = errors.New("mp3: frame header is too short")
+)
+
+// Version is an MPEG audio version
+type Version int
+
+// MPEG audio versions
+const (
+	MPEG25 Version = 0
+	MPEG2  Version = 2
+	MPEG1  Version = 3
+)
+
+func (v Version) String() string {
+	switch v {
+	case MPEG1:
+		return "MPEG-1"
+	case MPEG2:
+		return "MPEG-2"
+	case MPEG25:
+		return "MPEG-2.5"
+	default:
+		return "unknown"
+	}
+}
+
+// ChannelMode is a frame channel mode
+type ChannelMode int
+
+// Channel modes
+const (
+	Stereo      ChannelMode = 0
+	JointStereo ChannelMode = 1
+	DualChannel ChannelMode = 2
+	Mono        ChannelMode = 3
+)
+
+// bitrates in kbps indexed by [version is MPEG-1][layer-1][index]
+var bitrates = [2][3][15]int{
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+}
+
+// sample rates in Hz indexed by [version][index]
+var samplerates = [4][3]int{
+	MPEG25: {11025, 12000, 8000},
+	MPEG2:  {22050, 24000, 16000},
+	MPEG1:  {44100, 48000, 32000},
+}
+
+// Header is a parsed MPEG audio frame header
+type Header struct {
+	Version Version
+	// Layer is 1, 2 or 3
+	Layer int
+	// Protected is set when the header is followed by a CRC
+	Protected bool
+	// Bitrate in kbps
+	Bitrate int
+	// Samplerate in Hz
+	Samplerate  int
+	Padding     bool
+	ChannelMode ChannelMode
+}
+
+// ParseHeader parses a frame header from the first 4 bytes of b
+func ParseHeader(b []byte) (Header, error) {
+	var h Header
+	if len(b) < HeaderSize {
+		return h, ErrShortHeader
+	}
+	if b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return h, ErrNoSync
+	}
+
+	h.Version = Version(b[1] >> 3 & 3)
+	layer := int(b[1] >> 1 & 3)
+	bitrateIndex := int(b[2] >> 4)
+	samplerateIndex := int(b[2] >> 2 & 3)
+	if h.Version == 1 || layer == 0 || bitrateIndex == 15 || samplerateIndex == 3 {
+		return h, ErrInvalid
+	}
+	if bitrateIndex == 0 {
+		return h, ErrFreeFormat
+	}
+
+	h.Layer = 4 - layer
+	h.Protected = b[1]&1 == 0
+	v1 := 0
+	if h.Version == MPEG1 {
+		v1 = 1
+	}
+	h.Bitrate = bitrates[v1][h.Layer-1][bitrateIndex]
+	h.Samplerate = samplerates[h.Version][samplerateIndex]
+	h.Padding = b[2]>>1&1 == 1
+	h.ChannelMode = ChannelMode(b[3] >> 6)
+	return h, nil
+}
+
+// Channels returns the number of channels
+func (h Header) Channels() int {
+	if h.ChannelMode == Mono {
+		return 1
+	}
+	return 2
+}
+
+// Samples returns the number of samples per channel in the frame
+func (h Header) Samples() int {
+	switch {
+	case h.Layer == 1:
+		return 384
+	case h.Layer == 3 && h.Version != MPEG1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// Size returns the frame size in bytes including the header
+func (h Header) Size() int {
+	var padding int
+	if h.Padding {
+		padding = 1
+	}
+	if h.Layer == 1 {
+		return (12*h.Bitrate*1000/h.Samplerate + padding) * 4
+	}
+	return h.Samples()/8*h.Bitrate*1000/h.Samplerate + padding
+}
+
+// SideInfoSize returns the size of layer III side information following
+// the header and the CRC
+func (h Header) SideInfoSize() int {
+	switch {
+	case h.Version == MPEG1 && h.ChannelMode != Mono:
+		return 32
+	case h.Version == MPEG1 || h.ChannelMode != Mono:
+		return 17
+	default:
+		return 9
+	}
+}
@@ -0,0 +1,63 @@
+package mp3
+
+import (
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		header     []byte
+		version    Version
+		layer      int
+		bitrate    int
+		samplerate int
+		channels   int
+		samples    int
+		size       int
+	}{
+		{[]byte{0xff, 0xfb, 0x90, 0x44}, MPEG1, 3, 128, 44100, 2, 1152, 417},
+		{[]byte{0xff, 0xfb, 0x92, 0x44}, MPEG1, 3, 128, 44100, 2, 1152, 418},
+		{[]byte{0xff, 0xfb, 0xe4, 0xc4}, MPEG1, 3, 320, 48000, 1, 1152, 960},
+		{[]byte{0xff, 0xf3, 0x48, 0xc4}, MPEG2, 3, 32, 16000, 1, 576, 144},
+		{[]byte{0xff, 0xe3, 0x18, 0x44}, MPEG25, 3, 8, 8000, 2, 576, 72},
+		{[]byte{0xff, 0xfd, 0x70, 0x04}, MPEG1, 2, 112, 44100, 2, 1152, 365},
+		{[]byte{0xff, 0xff, 0x40, 0x04}, MPEG1, 1, 128, 44100, 2, 384, 136},
+	}
+	for _, test := range tests {
+		h, err := ParseHeader(test.header)
+		if err != nil {
+			t.Errorf("%x: %v", test.header, err)
+			continue
+		}
+		if h.Version != test.version || h.Layer != test.layer || h.Bitrate != test.bitrate ||
+			h.Samplerate != test.samplerate || h.Channels() != test.channels {
+			t.Errorf("%x: unexpected header %+v", test.header, h)
+		}
+		if h.Samples() != test.samples {
+			t.Errorf("%x: %d samples, expected %d", test.header, h.Samples(), test.samples)
+		}
+		if h.Size() != test.size {
+			t.Errorf("%x: frame size %d, expected %d", test.header, h.Size(), test.size)
+		}
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	tests := []struct {
+		header []byte
+		err    error
+	}{
+		{[]byte{0xff, 0xfb}, ErrShortHeader},
+		{[]byte{'I', 'D', '3', 4}, ErrNoSync},
+		{[]byte{0xff, 0xeb, 0x90, 0x44}, ErrInvalid},
+		{[]byte{0xff, 0xf9, 0x90, 0x44}, ErrInvalid},
+		{[]byte{0xff, 0xfb, 0xf0, 0x44}, ErrInvalid},
+		{[]byte{0xff, 0xfb, 0x9c, 0x44}, ErrInvalid},
+		{[]byte{0xff, 0xfb, 0x00, 0x44}, ErrFreeFormat},
+	}
+	for _, test := range tests {
+		if _, err := ParseHeader(test.header); err != test.err {
+			t.Errorf("%x: expected %v, got %v", test.header, test.err, err)
+		}
+	}
+}
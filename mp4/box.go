@@ -0,0 +1,77 @@
+package mp4
+
+import (
+	"encoding/binary"
+)
+
+// boxWriter builds nested ISO-BMFF boxes, sizes are filled in by end
+type boxWriter struct {
+	buf    []byte
+	starts []int
+}
+
+func (b *boxWriter) start(typ string) {
+	b.starts = append(b.starts, len(b.buf))
+	b.u32(0)
+	b.buf = append(b.buf, typ...)
+}
+
+// startFull starts a full box with the version and 24 bit flags
+func (b *boxWriter) startFull(typ string, version byte, flags uint32) {
+	b.start(typ)
+	b.u32(uint32(version)<<24 | flags&0xffffff)
+}
+
+func (b *boxWriter) end() {
+	start := b.starts[len(b.starts)-1]
+	b.starts = b.starts[:len(b.starts)-1]
+	binary.BigEndian.PutUint32(b.buf[start:], uint32(len(b.buf)-start))
+}
+
+func (b *boxWriter) u8(v uint8) {
+	b.buf = append(b.buf, v)
+}
+
+func (b *boxWriter) u16(v uint16) {
+	b.buf = append(b.buf, byte(v>>8), byte(v))
+}
+
+func (b *boxWriter) u24(v uint32) {
+	b.buf = append(b.buf, byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *boxWriter) u32(v uint32) {
+	b.buf = append(b.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *boxWriter) u64(v uint64) {
+	b.u32(uint32(v >> 32))
+	b.u32(uint32(v))
+}
+
+func (b *boxWriter) zeros(n int) {
+	for i := 0; i < n; i++ {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// matrix writes the unity transformation matrix of mvhd and tkhd
+func (b *boxWriter) matrix() {
+	for _, v := range []uint32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000} {
+		b.u32(v)
+	}
+}
+
+// descriptor starts an MPEG-4 descriptor of esds, the size is one byte
+// as the descriptors written are small
+func (b *boxWriter) descriptor(tag byte) {
+	b.u8(tag)
+	b.starts = append(b.starts, len(b.buf))
+	b.u8(0)
+}
+
+func (b *boxWriter) endDescriptor() {
+	start := b.starts[len(b.starts)-1]
+	b.starts = b.starts[:len(b.starts)-1]
+	b.buf[start] = byte(len(b.buf) - start - 1)
+}
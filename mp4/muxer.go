@@ -0,0 +1,389 @@
+// Package mp4 muxes MP3 frames into fragmented MP4 (ISO-BMFF)
+//  The output is an init segment with the movie box describing an 'mp4a'
+//  track with MPEG-1 audio object type 0x6B, or 0x69 for the MPEG-2 and
+//  MPEG-2.5 samplerates, and media segments of moof and mdat boxes,
+//  as DASH and Media Source Extensions expect them.
+//  The init segment is written on the first frame, its negative PTS is the
+//  encoder delay which the edit list skips, so players start at the first
+//  input sample. WriteFrame has the frame handler signature:
+//
+//    mux := mp4.NewMuxer(mp4.SingleFile(f), mp4.Config{})
+//    enc := lame.NewEncoder(nil, lame.WithFrameHandler(mux.WriteFrame))
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/viert/go-lame/mp3"
+)
+
+// DefaultSegmentDuration is the target media segment duration used by default
+const DefaultSegmentDuration = 4 * time.Second
+
+// DefaultTrackID is the id of the audio track used by default
+const DefaultTrackID = 1
+
+// MPEG-4 object types of MPEG audio including MP3
+const (
+	// ISO/IEC 11172-3, MPEG-1 audio
+	objectTypeMPEG1Audio = 0x6b
+	// ISO/IEC 13818-3, the lower samplerates of MPEG-2 and MPEG-2.5
+	objectTypeMPEG2Audio = 0x69
+)
+
+// movie timescale, the track one is the samplerate
+const movieTimescale = 1000
+
+var (
+	// ErrFormatChange is returned if the samplerate or the number of channels
+	// change, a track can't have them changed
+	ErrFormatChange = errors.New("mp4: samplerate or channels changed")
+	// ErrClosed is returned on writing to a closed muxer
+	ErrClosed = errors.New("mp4: muxer is closed")
+)
+
+// Segment is a media segment
+type Segment struct {
+	// Number is the sequence number starting with 1
+	Number uint32
+	// Start is the decode time of the first sample in timescale units,
+	// Duration is the segment duration in the same units
+	Start    uint64
+	Duration uint64
+	Data     []byte
+}
+
+// Output receives the init segment and the media segments
+//  Data is only valid until the method returns.
+type Output interface {
+	WriteInit(data []byte) error
+	WriteSegment(seg Segment) error
+}
+
+type singleFile struct {
+	w io.Writer
+}
+
+// SingleFile returns an output writing the segments one after another
+// to w, which makes a fragmented MP4 file
+func SingleFile(w io.Writer) Output {
+	return singleFile{w: w}
+}
+
+func (f singleFile) WriteInit(data []byte) error {
+	_, err := f.w.Write(data)
+	return err
+}
+
+func (f singleFile) WriteSegment(seg Segment) error {
+	_, err := f.w.Write(seg.Data)
+	return err
+}
+
+// Config describes the track and segments, zero values mean defaults
+type Config struct {
+	// SegmentDuration is the maximum media segment duration, segments are
+	// cut on frame boundaries so they're a bit shorter
+	SegmentDuration time.Duration
+	TrackID         uint32
+}
+
+// Muxer writes frames into media segments
+//  The init segment is written on the first frame, the track timescale
+//  is its samplerate.
+type Muxer struct {
+	out Output
+	cfg Config
+
+	header  mp3.Header
+	started bool
+	closed  bool
+
+	// frames collected for the segment, their sizes and duration in samples
+	frames   []byte
+	sizes    []uint32
+	duration uint64
+	// start is the decode time of the segment, number is the last segment one
+	start  uint64
+	number uint32
+
+	boxWriter boxWriter
+}
+
+// NewMuxer creates a muxer writing to out
+func NewMuxer(out Output, cfg Config) *Muxer {
+	if cfg.SegmentDuration <= 0 {
+		cfg.SegmentDuration = DefaultSegmentDuration
+	}
+	if cfg.TrackID == 0 {
+		cfg.TrackID = DefaultTrackID
+	}
+	return &Muxer{out: out, cfg: cfg}
+}
+
+// Timescale returns the track timescale, 0 before the first frame
+func (m *Muxer) Timescale() int {
+	return m.header.Samplerate
+}
+
+// WriteFrame adds a frame to the current media segment
+//  The segment is written when the frame doesn't fit into the segment duration.
+func (m *Muxer) WriteFrame(f mp3.Frame) error {
+	if m.closed {
+		return ErrClosed
+	}
+	if !m.started {
+		m.header = f.Header
+		m.started = true
+		var delay int64
+		if f.PTS < 0 {
+			delay = -f.PTS
+		}
+		if err := m.out.WriteInit(m.initSegment(delay)); err != nil {
+			return err
+		}
+	} else if f.Header.Samplerate != m.header.Samplerate || f.Header.Channels() != m.header.Channels() {
+		return ErrFormatChange
+	}
+
+	samples := uint64(f.Duration())
+	if len(m.sizes) > 0 && m.segmentTime(m.duration+samples) > m.cfg.SegmentDuration {
+		if err := m.Flush(); err != nil {
+			return err
+		}
+	}
+	m.frames = append(m.frames, f.Data...)
+	m.sizes = append(m.sizes, uint32(len(f.Data)))
+	m.duration += samples
+	return nil
+}
+
+// Flush writes the frames collected as a media segment
+func (m *Muxer) Flush() error {
+	if len(m.sizes) == 0 {
+		return nil
+	}
+	m.number++
+	seg := Segment{
+		Number:   m.number,
+		Start:    m.start,
+		Duration: m.duration,
+		Data:     m.mediaSegment(),
+	}
+	m.start += m.duration
+	m.duration = 0
+	m.frames = m.frames[:0]
+	m.sizes = m.sizes[:0]
+	return m.out.WriteSegment(seg)
+}
+
+// Close writes the last media segment
+func (m *Muxer) Close() error {
+	if m.closed {
+		return nil
+	}
+	err := m.Flush()
+	m.closed = true
+	return err
+}
+
+func (m *Muxer) segmentTime(samples uint64) time.Duration {
+	return time.Duration(samples * uint64(time.Second) / uint64(m.header.Samplerate))
+}
+
+// initSegment returns ftyp and moov boxes, the edit list starts
+// the presentation delay samples into the media
+func (m *Muxer) initSegment(delay int64) []byte {
+	b := &m.boxWriter
+	b.buf = b.buf[:0]
+	h := m.header
+
+	b.start("ftyp")
+	b.buf = append(b.buf, "iso6"...)
+	b.u32(0)
+	b.buf = append(b.buf, "iso6dashmp41"...)
+	b.end()
+
+	b.start("moov")
+	b.startFull("mvhd", 0, 0)
+	b.u32(0) // creation time
+	b.u32(0) // modification time
+	b.u32(movieTimescale)
+	b.u32(0)       // duration is unknown
+	b.u32(0x10000) // rate 1.0
+	b.u16(0x100)   // volume 1.0
+	b.zeros(10)
+	b.matrix()
+	b.zeros(24)
+	b.u32(m.cfg.TrackID + 1) // next track id
+	b.end()
+
+	b.start("trak")
+	b.startFull("tkhd", 0, 3) // enabled and in movie
+	b.u32(0)
+	b.u32(0)
+	b.u32(m.cfg.TrackID)
+	b.u32(0)
+	b.u32(0) // duration
+	b.zeros(8)
+	b.u16(0)     // layer
+	b.u16(0)     // alternate group
+	b.u16(0x100) // volume 1.0
+	b.u16(0)
+	b.matrix()
+	b.u32(0) // width
+	b.u32(0) // height
+	b.end()
+
+	// the edit is as long as the media, which is unknown in fragmented files
+	b.start("edts")
+	b.startFull("elst", 0, 0)
+	b.u32(1)
+	b.u32(0)
+	b.u32(uint32(delay))
+	b.u16(1) // media rate 1.0
+	b.u16(0)
+	b.end()
+	b.end()
+
+	b.start("mdia")
+	b.startFull("mdhd", 0, 0)
+	b.u32(0)
+	b.u32(0)
+	b.u32(uint32(h.Samplerate))
+	b.u32(0)
+	b.u16(0x55c4) // und
+	b.u16(0)
+	b.end()
+
+	b.startFull("hdlr", 0, 0)
+	b.u32(0)
+	b.buf = append(b.buf, "soun"...)
+	b.zeros(12)
+	b.buf = append(b.buf, "SoundHandler\x00"...)
+	b.end()
+
+	b.start("minf")
+	b.startFull("smhd", 0, 0)
+	b.u16(0) // balance
+	b.u16(0)
+	b.end()
+	b.start("dinf")
+	b.startFull("dref", 0, 0)
+	b.u32(1)
+	b.startFull("url ", 0, 1) // media data is in this file
+	b.end()
+	b.end()
+	b.end()
+
+	b.start("stbl")
+	b.startFull("stsd", 0, 0)
+	b.u32(1)
+	m.sampleEntry()
+	b.end()
+	for _, typ := range []string{"stts", "stsc", "stco"} {
+		b.startFull(typ, 0, 0)
+		b.u32(0)
+		b.end()
+	}
+	b.startFull("stsz", 0, 0)
+	b.u32(0)
+	b.u32(0)
+	b.end()
+	b.end() // stbl
+	b.end() // minf
+	b.end() // mdia
+	b.end() // trak
+
+	b.start("mvex")
+	b.startFull("trex", 0, 0)
+	b.u32(m.cfg.TrackID)
+	b.u32(1) // sample description index
+	b.u32(uint32(h.Samples()))
+	b.u32(0)
+	b.u32(0)
+	b.end()
+	b.end()
+	b.end() // moov
+	return b.buf
+}
+
+// sampleEntry writes the mp4a sample entry with the elementary stream descriptor
+func (m *Muxer) sampleEntry() {
+	b := &m.boxWriter
+	h := m.header
+	bitrate := uint32(h.Bitrate * 1000)
+	objectType := byte(objectTypeMPEG1Audio)
+	if h.Version != mp3.MPEG1 {
+		objectType = objectTypeMPEG2Audio
+	}
+
+	b.start("mp4a")
+	b.zeros(6)
+	b.u16(1) // data reference index
+	b.zeros(8)
+	b.u16(uint16(h.Channels()))
+	b.u16(16) // sample size
+	b.u16(0)
+	b.u16(0)
+	b.u32(uint32(h.Samplerate) << 16)
+
+	b.startFull("esds", 0, 0)
+	b.descriptor(0x03) // ES_Descriptor
+	b.u16(0)           // ES_ID
+	b.u8(0)
+	b.descriptor(0x04) // DecoderConfigDescriptor
+	b.u8(objectType)
+	b.u8(0x05<<2 | 1) // audio stream
+	b.u24(0)          // buffer size
+	b.u32(bitrate)    // max bitrate
+	b.u32(bitrate)    // average bitrate
+	b.endDescriptor()
+	b.descriptor(0x06) // SLConfigDescriptor
+	b.u8(0x02)
+	b.endDescriptor()
+	b.endDescriptor()
+	b.end()
+	b.end()
+}
+
+// mediaSegment returns moof and mdat boxes of the frames collected
+func (m *Muxer) mediaSegment() []byte {
+	b := &m.boxWriter
+	b.buf = b.buf[:0]
+
+	b.start("moof")
+	b.startFull("mfhd", 0, 0)
+	b.u32(m.number)
+	b.end()
+
+	b.start("traf")
+	b.startFull("tfhd", 0, 0x020000|0x000008) // default base is moof, default duration
+	b.u32(m.cfg.TrackID)
+	b.u32(uint32(m.header.Samples()))
+	b.end()
+	b.startFull("tfdt", 1, 0)
+	b.u64(m.start)
+	b.end()
+	b.startFull("trun", 0, 0x000001|0x000200) // data offset, sample sizes
+	b.u32(uint32(len(m.sizes)))
+	dataOffset := len(b.buf)
+	b.u32(0)
+	for _, size := range m.sizes {
+		b.u32(size)
+	}
+	b.end()
+	b.end() // traf
+	b.end() // moof
+
+	// the data starts after the mdat header
+	binary.BigEndian.PutUint32(b.buf[dataOffset:], uint32(len(b.buf)+8))
+
+	b.start("mdat")
+	b.buf = append(b.buf, m.frames...)
+	b.end()
+	return b.buf
+}
@@ -0,0 +1,253 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/viert/go-lame/internal/mp3test"
+	"github.com/viert/go-lame/mp3"
+)
+
+// containers are the boxes parsed for children
+var containers = map[string]bool{
+	"moov": true, "trak": true, "edts": true, "mdia": true, "minf": true,
+	"dinf": true, "stbl": true, "mvex": true, "moof": true, "traf": true,
+}
+
+type box struct {
+	typ      string
+	payload  []byte
+	children []box
+}
+
+func parseBoxes(t *testing.T, b []byte) []box {
+	var boxes []box
+	for len(b) > 0 {
+		if len(b) < 8 {
+			t.Fatalf("truncated box header % x", b)
+		}
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			t.Fatalf("invalid box size %d of %q", size, b[4:8])
+		}
+		bx := box{typ: string(b[4:8]), payload: b[8:size]}
+		if containers[bx.typ] {
+			bx.children = parseBoxes(t, bx.payload)
+		}
+		boxes = append(boxes, bx)
+		b = b[size:]
+	}
+	return boxes
+}
+
+// find returns the box at the path of box types
+func find(t *testing.T, boxes []box, path ...string) box {
+	for i, typ := range path {
+		found := false
+		for _, bx := range boxes {
+			if bx.typ == typ {
+				if i == len(path)-1 {
+					return bx
+				}
+				boxes = bx.children
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	t.Fatalf("box %v not found", path)
+	return box{}
+}
+
+type recorder struct {
+	init     []byte
+	segments []Segment
+}
+
+func (r *recorder) WriteInit(data []byte) error {
+	r.init = append([]byte(nil), data...)
+	return nil
+}
+
+func (r *recorder) WriteSegment(seg Segment) error {
+	seg.Data = append([]byte(nil), seg.Data...)
+	r.segments = append(r.segments, seg)
+	return nil
+}
+
+func TestMuxerInit(t *testing.T) {
+	out := new(recorder)
+	m := NewMuxer(out, Config{})
+	if err := m.WriteFrame(mp3test.Frames(1)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if m.Timescale() != 44100 {
+		t.Errorf("timescale is %d", m.Timescale())
+	}
+
+	boxes := parseBoxes(t, out.init)
+	if len(boxes) != 2 || boxes[0].typ != "ftyp" || boxes[1].typ != "moov" {
+		t.Fatalf("unexpected init segment boxes %v", boxes)
+	}
+
+	elst := find(t, boxes, "moov", "trak", "edts", "elst").payload
+	if entries, mediaTime := binary.BigEndian.Uint32(elst[4:]), binary.BigEndian.Uint32(elst[12:]); entries != 1 || mediaTime != mp3test.Delay {
+		t.Errorf("edit list has %d entries and media time %d", entries, mediaTime)
+	}
+	mdhd := find(t, boxes, "moov", "trak", "mdia", "mdhd").payload
+	if timescale := binary.BigEndian.Uint32(mdhd[12:]); timescale != 44100 {
+		t.Errorf("track timescale is %d", timescale)
+	}
+	hdlr := find(t, boxes, "moov", "trak", "mdia", "hdlr").payload
+	if string(hdlr[8:12]) != "soun" {
+		t.Errorf("handler type is %q", hdlr[8:12])
+	}
+
+	stsd := find(t, boxes, "moov", "trak", "mdia", "minf", "stbl", "stsd").payload
+	entries := parseBoxes(t, stsd[8:])
+	if len(entries) != 1 || entries[0].typ != "mp4a" {
+		t.Fatalf("unexpected sample entries %v", entries)
+	}
+	mp4a := entries[0].payload
+	channels, samplerate := binary.BigEndian.Uint16(mp4a[16:]), binary.BigEndian.Uint32(mp4a[24:])>>16
+	if channels != 2 || samplerate != 44100 {
+		t.Errorf("sample entry has %d channels at %dHz", channels, samplerate)
+	}
+	esds := parseBoxes(t, mp4a[28:])
+	expected := []byte{
+		0, 0, 0, 0,
+		0x03, 21, 0, 0, 0,
+		0x04, 13, 0x6b, 0x15, 0, 0, 0, 0, 1, 0xf4, 0, 0, 1, 0xf4, 0,
+		0x06, 1, 0x02,
+	}
+	if len(esds) != 1 || esds[0].typ != "esds" || !bytes.Equal(esds[0].payload, expected) {
+		t.Errorf("unexpected esds % x", esds[0].payload)
+	}
+
+	trex := find(t, boxes, "moov", "mvex", "trex").payload
+	if trackID, duration := binary.BigEndian.Uint32(trex[4:]), binary.BigEndian.Uint32(trex[12:]); trackID != DefaultTrackID || duration != 1152 {
+		t.Errorf("trex has track %d and default duration %d", trackID, duration)
+	}
+}
+
+func TestMuxerLowSamplerate(t *testing.T) {
+	// MPEG-2 Layer III 64kbps 22050Hz stereo
+	h, err := mp3.ParseHeader([]byte{0xff, 0xf3, 0x80, 0x44})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, h.Size())
+	copy(data, []byte{0xff, 0xf3, 0x80, 0x44})
+
+	out := new(recorder)
+	m := NewMuxer(out, Config{})
+	if err := m.WriteFrame(mp3.Frame{Header: h, Data: data, PTS: -576}); err != nil {
+		t.Fatal(err)
+	}
+	boxes := parseBoxes(t, out.init)
+	stsd := find(t, boxes, "moov", "trak", "mdia", "minf", "stbl", "stsd").payload
+	mp4a := parseBoxes(t, stsd[8:])[0].payload
+	if samplerate := binary.BigEndian.Uint32(mp4a[24:]) >> 16; samplerate != 22050 {
+		t.Errorf("sample entry samplerate is %d", samplerate)
+	}
+	esds := parseBoxes(t, mp4a[28:])[0].payload
+	if objectType := esds[11]; objectType != 0x69 {
+		t.Errorf("object type is %#x, expected 0x69 for MPEG-2 audio", objectType)
+	}
+}
+
+func TestMuxerSegments(t *testing.T) {
+	out := new(recorder)
+	// 4 frames are 104ms, so segments get 3 frames
+	m := NewMuxer(out, Config{SegmentDuration: 100 * time.Millisecond})
+	input := mp3test.Frames(7)
+	for _, f := range input {
+		if err := m.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteFrame(input[0]); err != ErrClosed {
+		t.Errorf("expected ErrClosed writing to a closed muxer, got %v", err)
+	}
+
+	if len(out.segments) != 3 {
+		t.Fatalf("expected 3 segments, got %d", len(out.segments))
+	}
+	counts := []int{3, 3, 1}
+	next := 0
+	for i, seg := range out.segments {
+		if seg.Number != uint32(i+1) || seg.Start != uint64(i*3*1152) || seg.Duration != uint64(counts[i]*1152) {
+			t.Errorf("segment %d: number %d, start %d, duration %d", i, seg.Number, seg.Start, seg.Duration)
+		}
+		boxes := parseBoxes(t, seg.Data)
+		mfhd := find(t, boxes, "moof", "mfhd").payload
+		if binary.BigEndian.Uint32(mfhd[4:]) != seg.Number {
+			t.Errorf("segment %d: moof sequence number differs", i)
+		}
+		tfdt := find(t, boxes, "moof", "traf", "tfdt").payload
+		if binary.BigEndian.Uint64(tfdt[4:]) != seg.Start {
+			t.Errorf("segment %d: decode time differs", i)
+		}
+
+		trun := find(t, boxes, "moof", "traf", "trun").payload
+		count := int(binary.BigEndian.Uint32(trun[4:]))
+		offset := int(binary.BigEndian.Uint32(trun[8:]))
+		if count != counts[i] {
+			t.Errorf("segment %d: %d samples, expected %d", i, count, counts[i])
+		}
+		for j := 0; j < count; j++ {
+			size := int(binary.BigEndian.Uint32(trun[12+4*j:]))
+			if !bytes.Equal(seg.Data[offset:offset+size], input[next].Data) {
+				t.Errorf("segment %d: sample %d differs from frame %d", i, j, next)
+			}
+			offset += size
+			next++
+		}
+		if mdat := find(t, boxes, "mdat"); offset != len(seg.Data) || len(mdat.payload) != count*417 {
+			t.Errorf("segment %d: samples don't fill mdat", i)
+		}
+	}
+}
+
+func TestMuxerSingleFile(t *testing.T) {
+	out := new(bytes.Buffer)
+	m := NewMuxer(SingleFile(out), Config{SegmentDuration: 100 * time.Millisecond})
+	for _, f := range mp3test.Frames(5) {
+		m.WriteFrame(f)
+	}
+	m.Close()
+
+	var types []string
+	for _, bx := range parseBoxes(t, out.Bytes()) {
+		types = append(types, bx.typ)
+	}
+	expected := []string{"ftyp", "moov", "moof", "mdat", "moof", "mdat"}
+	if len(types) != len(expected) {
+		t.Fatalf("file boxes are %v, expected %v", types, expected)
+	}
+	for i := range types {
+		if types[i] != expected[i] {
+			t.Errorf("file boxes are %v, expected %v", types, expected)
+			break
+		}
+	}
+}
+
+func TestMuxerFormatChange(t *testing.T) {
+	m := NewMuxer(new(recorder), Config{})
+	m.WriteFrame(mp3test.Frames(1)[0])
+	f := mp3test.Frames(2)[1]
+	// mono
+	f.Header.ChannelMode = mp3.Mono
+	if err := m.WriteFrame(f); err != ErrFormatChange {
+		t.Errorf("expected ErrFormatChange, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package lame
+
+import (
+	"io"
+)
+
+// DefaultOutputBufferSize is the size of the encoded data buffer used by default
+const DefaultOutputBufferSize = 4096
+
+// output buffers encoded data on its way to the underlying writer
+//  Every byte accepted by Write reaches the writer exactly once. Short writes
+//  are retried as long as the writer makes progress, data the writer failed
+//  to accept is kept pending and written first on the next Write or Flush.
+type output struct {
+	w    io.Writer
+	size int
+	buf  []byte
+}
+
+func newOutput(w io.Writer, size int) *output {
+	if size < 0 {
+		size = 0
+	}
+	return &output{w: w, size: size, buf: make([]byte, 0, size)}
+}
+
+// Write buffers p, the buffer is flushed when p doesn't fit into it
+//  p is always accepted as a whole, the error tells if the pending
+//  data couldn't be written.
+func (o *output) Write(p []byte) (int, error) {
+	if len(o.buf)+len(p) <= o.size {
+		o.buf = append(o.buf, p...)
+		return len(p), nil
+	}
+	if err := o.Flush(); err != nil {
+		o.buf = append(o.buf, p...)
+		return len(p), err
+	}
+	if len(p) <= o.size {
+		o.buf = append(o.buf, p...)
+		return len(p), nil
+	}
+	// large chunks bypass the buffer
+	n, err := writeFull(o.w, p)
+	if err != nil {
+		o.buf = append(o.buf, p[n:]...)
+	}
+	return len(p), err
+}
+
+// Flush writes the pending data to the underlying writer
+func (o *output) Flush() error {
+	if len(o.buf) == 0 {
+		return nil
+	}
+	n, err := writeFull(o.w, o.buf)
+	// move the rest to the beginning so the buffer doesn't grow
+	o.buf = o.buf[:copy(o.buf, o.buf[n:])]
+	return err
+}
+
+// Buffered returns the number of bytes pending
+func (o *output) Buffered() int {
+	return len(o.buf)
+}
+
+// writeFull writes p retrying short writes
+//  io.ErrShortWrite is returned if the writer stops making progress
+//  without an error
+func writeFull(w io.Writer, p []byte) (int, error) {
+	var written int
+	for written < len(p) {
+		n, err := w.Write(p[written:])
+		if n < 0 || n > len(p)-written {
+			return written, io.ErrShortWrite
+		}
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,97 @@
+package lame
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// choppyWriter accepts at most max bytes per call and fails when failAt calls are made
+type choppyWriter struct {
+	bytes.Buffer
+	max    int
+	calls  int
+	failAt int
+	stall  bool
+}
+
+var errChoppy = errors.New("choppy writer failure")
+
+func (w *choppyWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if w.calls == w.failAt {
+		return 0, errChoppy
+	}
+	if w.stall {
+		return 0, nil
+	}
+	if len(p) > w.max {
+		p = p[:w.max]
+	}
+	return w.Buffer.Write(p)
+}
+
+func sequence(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+func TestOutputShortWrites(t *testing.T) {
+	for _, size := range []int{0, 16, DefaultOutputBufferSize} {
+		w := &choppyWriter{max: 7}
+		o := newOutput(w, size)
+		data := sequence(1000)
+		for i := 0; i < len(data); i += 100 {
+			n, err := o.Write(data[i : i+100])
+			if n != 100 || err != nil {
+				t.Fatalf("buffer size %d: Write returned %d, %v", size, n, err)
+			}
+		}
+		if err := o.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(w.Bytes(), data) {
+			t.Errorf("buffer size %d: data written doesn't match the input", size)
+		}
+	}
+}
+
+func TestOutputErrorKeepsData(t *testing.T) {
+	w := &choppyWriter{max: 30, failAt: 2}
+	o := newOutput(w, 0)
+	data := sequence(100)
+
+	n, err := o.Write(data)
+	if n != len(data) || err != errChoppy {
+		t.Fatalf("Write returned %d, %v, expected %d and the writer error", n, err, len(data))
+	}
+	if o.Buffered() != 70 {
+		t.Errorf("%d bytes pending, expected 70", o.Buffered())
+	}
+	if err = o.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), data) {
+		t.Errorf("data is lost or duplicated after the writer failure")
+	}
+}
+
+func TestOutputStall(t *testing.T) {
+	w := &choppyWriter{stall: true}
+	o := newOutput(w, 4)
+	if _, err := o.Write(sequence(10)); err != io.ErrShortWrite {
+		t.Errorf("expected io.ErrShortWrite, got %v", err)
+	}
+	w.stall = false
+	w.max = 3
+	if err := o.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), sequence(10)) {
+		t.Errorf("unexpected data %v", w.Bytes())
+	}
+}
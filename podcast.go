@@ -0,0 +1,73 @@
+package lame
+
+import (
+	"github.com/viert/go-lame/id3"
+)
+
+// ID3TagSetPodcast marks the file as a podcast episode with iTunes PCST frame
+func (e *Encoder) ID3TagSetPodcast(podcast bool) {
+	if podcast {
+		e.ID3TagSetFrame(&id3.PodcastFrame{})
+	} else {
+		e.removeID3Frame("PCST")
+	}
+}
+
+// ID3TagSetPodcastFeedURL sets podcast feed URL, iTunes WFED frame
+func (e *Encoder) ID3TagSetPodcastFeedURL(url string) {
+	e.setID3TextFrame("WFED", url)
+}
+
+// ID3TagSetPodcastID sets podcast episode GUID, iTunes TGID frame
+func (e *Encoder) ID3TagSetPodcastID(guid string) {
+	e.setID3TextFrame("TGID", guid)
+}
+
+// ID3TagSetPodcastDescription sets podcast episode description, iTunes TDES frame
+func (e *Encoder) ID3TagSetPodcastDescription(description string) {
+	e.setID3TextFrame("TDES", description)
+}
+
+// ID3TagSetPodcastCategory sets podcast category, iTunes TCAT frame
+func (e *Encoder) ID3TagSetPodcastCategory(category string) {
+	e.setID3TextFrame("TCAT", category)
+}
+
+// ID3TagSetArtistURL sets official artist webpage, WOAR frame
+func (e *Encoder) ID3TagSetArtistURL(url string) {
+	e.setID3URLFrame("WOAR", url)
+}
+
+// ID3TagSetSourceURL sets official audio source webpage, WOAS frame
+func (e *Encoder) ID3TagSetSourceURL(url string) {
+	e.setID3URLFrame("WOAS", url)
+}
+
+// ID3TagSetUserURL sets user defined URL link, WXXX frame
+//  Links with different descriptions are kept as separate frames
+func (e *Encoder) ID3TagSetUserURL(description string, url string) {
+	f := &id3.UserURLFrame{Description: description, URL: url}
+	if url == "" {
+		e.removeID3Frame(id3FrameKey(f))
+		return
+	}
+	e.ID3TagSetFrame(f)
+}
+
+// setID3TextFrame sets a text frame, empty value removes it
+func (e *Encoder) setID3TextFrame(id string, value string) {
+	if value == "" {
+		e.removeID3Frame(id)
+		return
+	}
+	e.ID3TagSetFrame(&id3.TextFrame{FrameID: id, Values: []string{value}})
+}
+
+// setID3URLFrame sets a URL link frame, empty URL removes it
+func (e *Encoder) setID3URLFrame(id string, url string) {
+	if url == "" {
+		e.removeID3Frame(id)
+		return
+	}
+	e.ID3TagSetFrame(&id3.URLFrame{FrameID: id, URL: url})
+}
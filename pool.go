@@ -0,0 +1,249 @@
+package lame
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// ErrForeignEncoder is returned on putting an encoder the pool hasn't created
+var ErrForeignEncoder = errors.New("lame: encoder doesn't belong to the pool")
+
+// ErrEncoderIdle is returned on putting an encoder which is already in the pool
+var ErrEncoderIdle = errors.New("lame: encoder is already in the pool")
+
+// ErrPoolClosed is returned on getting an encoder from a closed pool
+var ErrPoolClosed = errors.New("lame: pool is closed")
+
+// PoolStats holds pool metrics
+type PoolStats struct {
+	// Hits is the number of Get calls served with an idle encoder
+	Hits uint64
+	// Misses is the number of Get calls which created a new encoder
+	Misses uint64
+	// Live is the number of lame handles open, both idle and in use
+	Live int
+	// Idle is the number of encoders waiting in the pool
+	Idle int
+}
+
+// Pool keeps configured encoders for reuse
+//  Encoders are keyed by EncoderConfig. An encoder returned with Put is reset,
+//  the next Get of the same config continues on its lame handle with
+//  lame_init_bitstream instead of the full lame_init and lame_init_params,
+//  the buffers are reused too. The number of live lame handles
+//  is capped, idle encoders of other configs are closed to make room for new
+//  ones. Encoders got from the pool must not be reconfigured.
+type Pool struct {
+	mu     sync.Mutex
+	idle   map[EncoderConfig][]*Encoder
+	tokens chan struct{}
+	stats  PoolStats
+	closed bool
+}
+
+// NewPool creates a pool with at most maxLive lame handles open, 0 means no limit
+func NewPool(maxLive int) *Pool {
+	p := &Pool{idle: make(map[EncoderConfig][]*Encoder)}
+	if maxLive > 0 {
+		p.tokens = make(chan struct{}, maxLive)
+	}
+	return p
+}
+
+// Get returns an encoder configured with cfg writing to w
+//  If the live handles limit is reached and no idle encoder can be closed,
+//  Get waits until an encoder is returned to the pool or ctx is done.
+func (p *Pool) Get(ctx context.Context, w io.Writer, cfg EncoderConfig) (*Encoder, error) {
+	enc, err := p.takeIdle(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if enc != nil {
+		enc.mu.Lock()
+		enc.setWriter(w)
+		enc.mu.Unlock()
+		return enc, nil
+	}
+
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	enc = NewEncoder(w)
+	if err := enc.Configure(cfg); err != nil {
+		enc.Close()
+		p.release()
+		return nil, err
+	}
+	enc.pool = p
+	enc.poolKey = cfg
+	return enc, nil
+}
+
+// Put resets the encoder and returns it to the pool
+//  The stream is expected to be flushed, the data which is not is dropped.
+//  Closed encoders, e.g. the ones aborted by the context, release their handles,
+//  so do all the encoders put after the pool is closed.
+func (p *Pool) Put(enc *Encoder) error {
+	p.mu.Lock()
+	if enc.pool != p {
+		p.mu.Unlock()
+		return ErrForeignEncoder
+	}
+	if enc.idle {
+		p.mu.Unlock()
+		return ErrEncoderIdle
+	}
+	enc.idle = true
+	p.mu.Unlock()
+
+	enc.mu.Lock()
+	enc.setWriter(ioutil.Discard)
+	enc.ctx = nil
+	enc.mu.Unlock()
+
+	if err := enc.Reset(ioutil.Discard); err != nil {
+		p.closeEncoder(enc)
+		return nil
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.closeEncoder(enc)
+		return nil
+	}
+	defer p.mu.Unlock()
+	p.idle[enc.poolKey] = append(p.idle[enc.poolKey], enc)
+	p.stats.Idle++
+	return nil
+}
+
+// Stats returns pool metrics
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Close closes idle encoders, encoders in use are closed on Put
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = make(map[EncoderConfig][]*Encoder)
+	p.stats.Idle = 0
+	p.mu.Unlock()
+
+	var err error
+	for _, encoders := range idle {
+		for _, enc := range encoders {
+			if cerr := p.closeEncoder(enc); err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+func (p *Pool) takeIdle(cfg EncoderConfig) (*Encoder, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	encoders := p.idle[cfg]
+	if len(encoders) == 0 {
+		p.stats.Misses++
+		return nil, nil
+	}
+	enc := encoders[len(encoders)-1]
+	encoders[len(encoders)-1] = nil
+	p.idle[cfg] = encoders[:len(encoders)-1]
+	enc.idle = false
+	p.stats.Idle--
+	p.stats.Hits++
+	return enc, nil
+}
+
+// acquire reserves a live handle closing an idle encoder if necessary
+func (p *Pool) acquire(ctx context.Context) error {
+	if p.tokens == nil {
+		p.addLive(1)
+		return nil
+	}
+	select {
+	case p.tokens <- struct{}{}:
+		p.addLive(1)
+		return nil
+	default:
+	}
+
+	if enc := p.evict(); enc != nil {
+		// the handle of the encoder closed is handed over to the new one
+		enc.Close()
+		return nil
+	}
+
+	select {
+	case p.tokens <- struct{}{}:
+		p.addLive(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// evict takes an idle encoder of any config out of the pool
+//  The encoder is detached from the pool keeping its handle reserved.
+func (p *Pool) evict() *Encoder {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for cfg, encoders := range p.idle {
+		if len(encoders) == 0 {
+			continue
+		}
+		enc := encoders[0]
+		p.idle[cfg] = encoders[1:]
+		enc.idle = false
+		enc.pool = nil
+		p.stats.Idle--
+		return enc
+	}
+	return nil
+}
+
+// closeEncoder closes an encoder of the pool releasing its handle
+func (p *Pool) closeEncoder(enc *Encoder) error {
+	err := enc.Close()
+	p.discard(enc)
+	return err
+}
+
+// discard releases the handle of a closed encoder
+func (p *Pool) discard(enc *Encoder) {
+	p.mu.Lock()
+	owned := enc.pool == p
+	if owned {
+		enc.pool = nil
+	}
+	p.mu.Unlock()
+	if owned {
+		p.release()
+	}
+}
+
+func (p *Pool) release() {
+	p.addLive(-1)
+	if p.tokens != nil {
+		<-p.tokens
+	}
+}
+
+func (p *Pool) addLive(n int) {
+	p.mu.Lock()
+	p.stats.Live += n
+	p.mu.Unlock()
+}
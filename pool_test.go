@@ -0,0 +1,123 @@
+package lame
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	ctx := context.Background()
+	mono := EncoderConfig{NumChannels: 1, InSamplerate: 22050}
+	input := pcmInput(30000)
+
+	fresh := new(bytes.Buffer)
+	enc := NewEncoder(fresh)
+	enc.Configure(mono)
+	enc.Write(input)
+	enc.Close()
+
+	p := NewPool(2)
+	defer p.Close()
+	var reused []byte
+	for i := 0; i < 3; i++ {
+		out := new(bytes.Buffer)
+		enc, err := p.Get(ctx, out, mono)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enc.NumChannels() != 1 {
+			t.Error("pooled encoder is not configured")
+		}
+		enc.Write(input)
+		enc.Flush()
+		if err = p.Put(enc); err != nil {
+			t.Fatal(err)
+		}
+		// reused encoders continue on the same handle with lame_init_bitstream
+		switch {
+		case i == 0 && !bytes.Equal(out.Bytes(), fresh.Bytes()):
+			t.Errorf("encoder produced %d bytes, expected %d", out.Len(), fresh.Len())
+		case i == 1:
+			reused = out.Bytes()
+		case i > 1 && !bytes.Equal(out.Bytes(), reused):
+			t.Errorf("pass %d: encoder produced %d bytes, expected %d", i, out.Len(), len(reused))
+		}
+	}
+
+	stats := p.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Live != 1 || stats.Idle != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if err := p.Put(NewEncoder(ioutil.Discard)); err != ErrForeignEncoder {
+		t.Errorf("expected ErrForeignEncoder, got %v", err)
+	}
+}
+
+func TestPoolLimit(t *testing.T) {
+	ctx := context.Background()
+	p := NewPool(2)
+	defer p.Close()
+
+	a, _ := p.Get(ctx, ioutil.Discard, EncoderConfig{Brate: 64})
+	b, _ := p.Get(ctx, ioutil.Discard, EncoderConfig{Brate: 128})
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(timeout, ioutil.Discard, EncoderConfig{Brate: 192}); err != context.DeadlineExceeded {
+		t.Fatalf("expected Get to wait for a free handle, got %v", err)
+	}
+
+	// the idle encoder of another config is closed to make room
+	p.Put(a)
+	c, err := p.Get(ctx, ioutil.Discard, EncoderConfig{Brate: 192})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.closed {
+		t.Error("idle encoder is expected to be evicted")
+	}
+	if stats := p.Stats(); stats.Live != 2 || stats.Idle != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// aborted encoders release their handles on Put
+	c.Close()
+	p.Put(c)
+	p.Put(b)
+	if stats := p.Stats(); stats.Live != 1 || stats.Idle != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	ctx := context.Background()
+	p := NewPool(0)
+
+	a, _ := p.Get(ctx, ioutil.Discard, EncoderConfig{})
+	b, _ := p.Get(ctx, ioutil.Discard, EncoderConfig{})
+	p.Put(a)
+	if err := p.Put(a); err != ErrEncoderIdle {
+		t.Errorf("expected ErrEncoderIdle, got %v", err)
+	}
+	if stats := p.Stats(); stats.Idle != 1 {
+		t.Errorf("encoder put twice is queued %d times", stats.Idle)
+	}
+
+	p.Close()
+	if err := p.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	if !a.closed || !b.closed {
+		t.Error("encoders are expected to be closed with the pool")
+	}
+	if stats := p.Stats(); stats.Live != 0 || stats.Idle != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, err := p.Get(ctx, ioutil.Discard, EncoderConfig{}); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed getting from a closed pool, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package lame
+
+import (
+	"bytes"
+	"io"
+)
+
+// EncodingReader reads MP3 data encoded from a PCM stream on demand
+type EncodingReader struct {
+	enc     *Encoder
+	pcm     io.Reader
+	encoded bytes.Buffer
+	err     error
+}
+
+// NewEncodingReader creates a reader producing MP3 data from pcm
+//  PCM data is read and encoded as the MP3 data is read, no goroutine is
+//  involved. Tags can be set with Encoder before the first Read.
+func NewEncodingReader(pcm io.Reader, cfg EncoderConfig) (*EncodingReader, error) {
+	r := &EncodingReader{pcm: pcm}
+	r.enc = NewEncoder(&r.encoded, WithOutputBufferSize(0))
+	if err := r.enc.Configure(cfg); err != nil {
+		r.enc.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Encoder returns the underlying encoder
+func (r *EncodingReader) Encoder() *Encoder {
+	return r.enc
+}
+
+// Read implements io.Reader
+func (r *EncodingReader) Read(p []byte) (int, error) {
+	for r.encoded.Len() == 0 && r.err == nil {
+		r.err = r.fill()
+	}
+	if r.encoded.Len() > 0 {
+		return r.encoded.Read(p)
+	}
+	return 0, r.err
+}
+
+// fill encodes the next chunk of PCM data flushing the encoder
+// when the input is over
+func (r *EncodingReader) fill() error {
+	r.enc.mu.Lock()
+	defer r.enc.mu.Unlock()
+
+	if err := r.enc.check(); err != nil {
+		return err
+	}
+	if !r.enc.started {
+		// the tag written on init may be enough to return
+		if err := r.enc.initParams(); err != nil {
+			return err
+		}
+		if r.encoded.Len() > 0 {
+			return nil
+		}
+	}
+
+	buf := r.enc.pcmbuffer()
+	n, err := r.pcm.Read(buf)
+	if n > 0 {
+		if _, werr := r.enc.write(buf[:n]); werr != nil {
+			return werr
+		}
+	}
+	if err == io.EOF {
+		if _, ferr := r.enc.flush(); ferr != nil {
+			return ferr
+		}
+	}
+	return err
+}
+
+// Close closes the encoder, the PCM reader is not closed
+func (r *EncodingReader) Close() error {
+	r.encoded.Reset()
+	if r.err == nil {
+		r.err = io.ErrClosedPipe
+	}
+	return r.enc.Close()
+}
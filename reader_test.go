@@ -0,0 +1,60 @@
+package lame
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestEncodingReader(t *testing.T) {
+	input := pcmInput(100001)
+	cfg := EncoderConfig{NumChannels: 1, InSamplerate: 22050, Brate: 64}
+
+	written := new(bytes.Buffer)
+	enc := NewEncoder(written)
+	if err := enc.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	enc.Write(input)
+	enc.Close()
+
+	r, err := NewEncodingReader(bytes.NewReader(input), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Encoder().NumChannels() != 1 || r.Encoder().InSamplerate() != 22050 {
+		t.Error("config is not applied to the encoder")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 || !bytes.Equal(data, written.Bytes()) {
+		t.Errorf("EncodingReader produced %d bytes, Encoder produced %d", len(data), written.Len())
+	}
+	if n, err := r.Read(make([]byte, 10)); n != 0 || err == nil {
+		t.Errorf("Read after Close returned %d, %v", n, err)
+	}
+
+	r, _ = NewEncodingReader(bytes.NewReader(input), cfg)
+	r.Encoder().Close()
+	if n, err := r.Read(make([]byte, 10)); n != 0 || err != ErrEncoderClosed {
+		t.Errorf("Read with the encoder closed returned %d, %v", n, err)
+	}
+}
+
+func TestEncoderConfigurePreset(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	defer enc.Close()
+	// explicit values override the preset
+	err := enc.Configure(EncoderConfig{Preset: PresetV2, VBR: VBRMTRH, Quality: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc.Quality() != 7 {
+		t.Errorf("quality is %d, expected 7", enc.Quality())
+	}
+}
@@ -0,0 +1,117 @@
+package rtp
+
+import (
+	"github.com/viert/go-lame/mp3"
+)
+
+// maxReservoir is the largest main_data_begin, it's 9 bits in MPEG1
+const maxReservoir = 511
+
+// ADU descriptor sizes, the one byte form holds sizes up to 63
+const (
+	maxShortDescriptorSize = 1<<6 - 1
+	maxADUSize             = 1<<14 - 1
+)
+
+// aduConverter rearranges layer III frames into ADUs
+//  A frame's main data may start in the previous frames (the bit reservoir),
+//  an ADU is the frame header and side information followed by its own main
+//  data, wherever it lies.
+type aduConverter struct {
+	// reservoir keeps the main data bytes of the last frames
+	reservoir []byte
+}
+
+// convert returns the ADU of the frame, nil if its main data isn't available
+func (c *aduConverter) convert(f mp3.Frame) ([]byte, error) {
+	h := f.Header
+	if h.Layer != 3 {
+		return nil, ErrNotLayer3
+	}
+	offset := mp3.HeaderSize
+	if h.Protected {
+		offset += 2
+	}
+	sideEnd := offset + h.SideInfoSize()
+	if len(f.Data) < sideEnd {
+		return nil, ErrShortFrame
+	}
+	begin, bits := parseSideInfo(h, f.Data[offset:sideEnd])
+
+	start := len(c.reservoir) - begin
+	c.reservoir = append(c.reservoir, f.Data[sideEnd:]...)
+	size := (bits + 7) / 8
+
+	var adu []byte
+	if start >= 0 && start+size <= len(c.reservoir) && sideEnd+size <= maxADUSize {
+		adu = make([]byte, 0, sideEnd+size)
+		adu = append(adu, f.Data[:sideEnd]...)
+		adu = append(adu, c.reservoir[start:start+size]...)
+	}
+	if extra := len(c.reservoir) - maxReservoir; extra > 0 {
+		c.reservoir = c.reservoir[:copy(c.reservoir, c.reservoir[extra:])]
+	}
+	return adu, nil
+}
+
+// parseSideInfo returns main_data_begin and the sum of part2_3_length,
+// the size of the frame's main data in bits
+func parseSideInfo(h mp3.Header, b []byte) (mainDataBegin int, mainDataBits int) {
+	r := bitReader{b: b}
+	channels := h.Channels()
+	if h.Version == mp3.MPEG1 {
+		mainDataBegin = r.read(9)
+		// private bits and scfsi
+		if channels == 1 {
+			r.skip(5 + 4)
+		} else {
+			r.skip(3 + 8)
+		}
+		for i := 0; i < 2*channels; i++ {
+			mainDataBits += r.read(12)
+			r.skip(47)
+		}
+		return mainDataBegin, mainDataBits
+	}
+
+	mainDataBegin = r.read(8)
+	r.skip(channels)
+	for i := 0; i < channels; i++ {
+		mainDataBits += r.read(12)
+		r.skip(51)
+	}
+	return mainDataBegin, mainDataBits
+}
+
+// appendDescriptor appends an ADU descriptor: the continuation flag,
+// the descriptor type flag and the ADU size in 6 or 14 bits
+func appendDescriptor(b []byte, continuation bool, size int) []byte {
+	var flags byte
+	if continuation {
+		flags = 0x80
+	}
+	if size <= maxShortDescriptorSize {
+		return append(b, flags|byte(size))
+	}
+	return append(b, flags|0x40|byte(size>>8), byte(size))
+}
+
+// bitReader reads big endian bit fields
+type bitReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *bitReader) read(n int) int {
+	var v int
+	for i := 0; i < n; i++ {
+		bit := r.b[r.pos>>3] >> uint(7-r.pos&7) & 1
+		v = v<<1 | int(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) skip(n int) {
+	r.pos += n
+}
@@ -0,0 +1,105 @@
+package rtp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// setBits writes v into n bits of b starting at bit pos
+func setBits(b []byte, pos, n, v int) {
+	for i := 0; i < n; i++ {
+		bit := byte(v >> uint(n-1-i) & 1)
+		b[(pos+i)>>3] |= bit << uint(7-(pos+i)&7)
+	}
+}
+
+// monoFrame returns a mono frame with the side information set,
+// its main data region is 417-4-17 = 396 bytes filled with fill
+func monoFrame(index, mainDataBegin, mainDataSize int, fill byte) []byte {
+	f := frame([]byte{0xff, 0xfb, 0x90, 0xc4}, index)
+	side := f.Data[4:21]
+	setBits(side, 0, 9, mainDataBegin)
+	// part2_3_length of the first granule follows the private bits and scfsi
+	setBits(side, 18, 12, mainDataSize*8)
+	for i := 21; i < len(f.Data); i++ {
+		f.Data[i] = fill
+	}
+	return f.Data
+}
+
+func TestADUConverter(t *testing.T) {
+	var c aduConverter
+	f1 := frame([]byte{0xff, 0xfb, 0x90, 0xc4}, 0)
+	f1.Data = monoFrame(0, 0, 100, 1)
+	f2 := frame([]byte{0xff, 0xfb, 0x90, 0xc4}, 1)
+	// the main data starts after the 100 bytes of the first frame
+	f2.Data = monoFrame(1, 296, 400, 2)
+
+	adu, err := c.convert(f1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(adu, f1.Data[:21+100]) {
+		t.Error("the first ADU is expected to be the frame beginning")
+	}
+
+	adu, err = c.convert(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []byte
+	expected = append(expected, f2.Data[:21]...)
+	expected = append(expected, f1.Data[21+100:]...)
+	expected = append(expected, f2.Data[21:21+104]...)
+	if !bytes.Equal(adu, expected) {
+		t.Errorf("the second ADU is %d bytes, expected %d", len(adu), len(expected))
+	}
+	if len(c.reservoir) != maxReservoir {
+		t.Errorf("reservoir is %d bytes, expected %d", len(c.reservoir), maxReservoir)
+	}
+
+	// the main data of a frame joined mid-stream is lost
+	var joined aduConverter
+	if adu, err := joined.convert(f2); adu != nil || err != nil {
+		t.Errorf("expected the frame to be skipped, got %d bytes and %v", len(adu), err)
+	}
+}
+
+func TestPacketizerADU(t *testing.T) {
+	var packets packetRecorder
+	p := NewPacketizer(&packets, Config{Format: ADU, MTU: 200})
+	f := frame([]byte{0xff, 0xfb, 0x90, 0xc4}, 0)
+	f.Data = monoFrame(0, 0, 40, 1)
+	p.WriteFrame(f)
+	f = frame([]byte{0xff, 0xfb, 0x90, 0xc4}, 1)
+	f.Data = monoFrame(1, 356, 400, 2)
+	p.WriteFrame(f)
+
+	// the first ADU of 61 bytes fits into a packet with the short descriptor
+	first := parsePacket(t, packets[0])
+	if first.payloadType != DefaultPayloadTypeADU || first.payload[0] != 61 || len(first.payload) != 62 {
+		t.Errorf("unexpected first packet %+v", first)
+	}
+
+	// the second ADU of 421 bytes is fragmented with the long descriptor
+	fragments := packets[1:]
+	if len(fragments) != 3 {
+		t.Fatalf("expected 3 fragments, got %d", len(fragments))
+	}
+	var adu []byte
+	for i, b := range fragments {
+		pkt := parsePacket(t, b)
+		continuation := pkt.payload[0]&0x80 != 0
+		size := int(pkt.payload[0]&0x3f)<<8 | int(pkt.payload[1])
+		if continuation != (i > 0) || pkt.payload[0]&0x40 == 0 || size != 421 || len(b) > 200 {
+			t.Errorf("fragment %d: continuation %v, size %d", i, continuation, size)
+		}
+		if pkt.timestamp != 2351 {
+			t.Errorf("fragment %d: timestamp is %d", i, pkt.timestamp)
+		}
+		adu = append(adu, pkt.payload[2:]...)
+	}
+	if len(adu) != 421 || !bytes.Equal(adu[:21], f.Data[:21]) {
+		t.Error("fragments don't make up the ADU")
+	}
+}
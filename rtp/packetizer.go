@@ -0,0 +1,271 @@
+// Package rtp packs MPEG audio frames into RTP packets
+//  Two payload formats are supported: RFC 2250 MPEG audio with the static
+//  payload type 14, where a packet holds whole frames or a fragment of one,
+//  and RFC 5219 mpa-robust, where layer III frames are rearranged into
+//  ADUs (application data units) which don't depend on the previous
+//  packets, so a lost packet doesn't spoil the following ones.
+//  Both formats use the 90kHz clock. The packetizer takes frames, so it's
+//  used with the encoder frame handler, packets go to a writer, e.g.
+//  a connected UDP socket:
+//
+//    conn, _ := net.Dial("udp", "239.0.0.1:5004")
+//    p := rtp.NewPacketizer(conn, rtp.Config{SSRC: 0x1234})
+//    enc := lame.NewEncoder(nil, lame.WithFrameHandler(p.WriteFrame))
+package rtp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/viert/go-lame/mp3"
+)
+
+// Format is an RTP payload format
+type Format int
+
+// Payload formats
+const (
+	// MPA is RFC 2250 MPEG audio
+	MPA Format = iota
+	// ADU is RFC 5219 loss tolerant MP3, mpa-robust
+	ADU
+)
+
+// RTP constants
+const (
+	// HeaderSize is the size of the RTP header without CSRC
+	HeaderSize = 12
+	// ClockRate is the timestamp clock rate of both formats
+	ClockRate = 90000
+	// PayloadTypeMPA is the static payload type of MPEG audio
+	PayloadTypeMPA = 14
+	// DefaultPayloadTypeADU is the dynamic payload type used for ADU by default
+	DefaultPayloadTypeADU = 96
+	// DefaultMTU is the maximum packet size used by default, it leaves room
+	// for IP and UDP headers and tunnels within the Ethernet MTU
+	DefaultMTU = 1200
+	// MinMTU is the smallest packet size allowed
+	MinMTU = 64
+)
+
+const (
+	rtpVersion    = 2
+	mpaHeaderSize = 4
+)
+
+var (
+	// ErrNotLayer3 is returned on writing a frame of another layer in ADU format
+	ErrNotLayer3 = errors.New("rtp: ADU format requires layer III frames")
+	// ErrShortFrame is returned if a frame is too short for its side information
+	ErrShortFrame = errors.New("rtp: frame is too short")
+)
+
+// Config describes the RTP stream, zero values mean defaults
+//  RFC 3550 recommends random initial Sequence and Timestamp values
+//  and a random SSRC, they're used as is here.
+type Config struct {
+	Format Format
+	// PayloadType is 14 for MPA and 96 for ADU by default
+	PayloadType uint8
+	SSRC        uint32
+	// Sequence is the sequence number of the first packet
+	Sequence uint16
+	// Timestamp is the timestamp of the first frame
+	Timestamp uint32
+	// MTU is the maximum packet size including the RTP header,
+	// larger frames are fragmented
+	MTU int
+	// FramesPerPacket is the maximum number of frames sent in one packet,
+	// frames are collected until the packet is full or Flush is called
+	FramesPerPacket int
+}
+
+// Packetizer packs frames into RTP packets written one per Write call
+//  The first packet has the marker bit set.
+type Packetizer struct {
+	w   io.Writer
+	cfg Config
+
+	seq    uint16
+	marker bool
+	// samples at samplerate since base, which is in 90kHz units,
+	// the timestamp clock is rebased when the samplerate changes
+	base       int64
+	samples    int64
+	samplerate int
+
+	adu aduConverter
+	// payload of the packet being collected and its frame count and timestamp
+	payload   []byte
+	frames    int
+	timestamp uint32
+	packet    []byte
+}
+
+// NewPacketizer creates a packetizer writing packets to w
+func NewPacketizer(w io.Writer, cfg Config) *Packetizer {
+	if cfg.PayloadType == 0 {
+		cfg.PayloadType = PayloadTypeMPA
+		if cfg.Format == ADU {
+			cfg.PayloadType = DefaultPayloadTypeADU
+		}
+	}
+	if cfg.MTU <= 0 {
+		cfg.MTU = DefaultMTU
+	}
+	if cfg.MTU < MinMTU {
+		cfg.MTU = MinMTU
+	}
+	if cfg.FramesPerPacket <= 0 {
+		cfg.FramesPerPacket = 1
+	}
+	return &Packetizer{
+		w:      w,
+		cfg:    cfg,
+		seq:    cfg.Sequence,
+		marker: true,
+	}
+}
+
+// WriteFrame packs a frame, the packet is sent when it's full
+//  In ADU format the frames whose main data lies in the frames not seen,
+//  e.g. the first frames written mid-stream, are skipped.
+func (p *Packetizer) WriteFrame(f mp3.Frame) error {
+	timestamp := p.clock(f.Header.Samplerate)
+	p.samples += int64(f.Duration())
+
+	data, unit := f.Data, f.Data
+	if p.cfg.Format == ADU {
+		adu, err := p.adu.convert(f)
+		if err != nil || adu == nil {
+			return err
+		}
+		data = adu
+		unit = appendDescriptor(nil, false, len(adu))
+		unit = append(unit, adu...)
+	}
+
+	max := p.maxPayload()
+	if len(unit) > max {
+		if err := p.Flush(); err != nil {
+			return err
+		}
+		return p.fragment(data, timestamp)
+	}
+	if p.frames > 0 && len(p.payload)+len(unit) > max {
+		if err := p.Flush(); err != nil {
+			return err
+		}
+	}
+	if p.frames == 0 {
+		p.timestamp = timestamp
+	}
+	p.payload = append(p.payload, unit...)
+	p.frames++
+	if p.frames >= p.cfg.FramesPerPacket {
+		return p.Flush()
+	}
+	return nil
+}
+
+// Flush sends the frames collected
+func (p *Packetizer) Flush() error {
+	if p.frames == 0 {
+		return nil
+	}
+	err := p.send(p.timestamp, 0, p.payload)
+	p.payload = p.payload[:0]
+	p.frames = 0
+	return err
+}
+
+// fragment sends a frame or an ADU which doesn't fit into a packet
+//  MPA fragments have the offset in the MPEG audio header, ADU fragments
+//  repeat the descriptor with the continuation flag.
+func (p *Packetizer) fragment(data []byte, timestamp uint32) error {
+	max := p.maxPayload()
+	if p.cfg.Format == MPA {
+		for offset := 0; offset < len(data); offset += max {
+			end := offset + max
+			if end > len(data) {
+				end = len(data)
+			}
+			if err := p.send(timestamp, offset, data[offset:end]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var fragment []byte
+	for offset := 0; offset < len(data); {
+		fragment = appendDescriptor(fragment[:0], offset > 0, len(data))
+		end := offset + max - len(fragment)
+		if end > len(data) {
+			end = len(data)
+		}
+		fragment = append(fragment, data[offset:end]...)
+		if err := p.send(timestamp, 0, fragment); err != nil {
+			return err
+		}
+		offset = end
+	}
+	return nil
+}
+
+// send writes a packet, offset is the MPA fragment offset
+func (p *Packetizer) send(timestamp uint32, offset int, payload []byte) error {
+	b := p.packet[:0]
+	var marker byte
+	if p.marker {
+		marker = 0x80
+	}
+	b = append(b, rtpVersion<<6, marker|p.cfg.PayloadType&0x7f)
+	b = appendUint16(b, p.seq)
+	b = appendUint32(b, timestamp)
+	b = appendUint32(b, p.cfg.SSRC)
+	if p.cfg.Format == MPA {
+		b = append(b, 0, 0)
+		b = appendUint16(b, uint16(offset))
+	}
+	b = append(b, payload...)
+	p.packet = b
+
+	p.seq++
+	p.marker = false
+	_, err := p.w.Write(b)
+	return err
+}
+
+// clock returns the timestamp of the next frame
+func (p *Packetizer) clock(samplerate int) uint32 {
+	if samplerate != p.samplerate {
+		if p.samplerate != 0 {
+			p.base += p.samples * ClockRate / int64(p.samplerate)
+		}
+		p.samples = 0
+		p.samplerate = samplerate
+	}
+	return p.cfg.Timestamp + uint32(p.base+p.samples*ClockRate/int64(samplerate))
+}
+
+func (p *Packetizer) maxPayload() int {
+	max := p.cfg.MTU - HeaderSize
+	if p.cfg.Format == MPA {
+		max -= mpaHeaderSize
+	}
+	return max
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
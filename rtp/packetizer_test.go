@@ -0,0 +1,149 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/viert/go-lame/mp3"
+)
+
+// packet is a parsed RTP packet
+type packet struct {
+	marker      bool
+	payloadType uint8
+	seq         uint16
+	timestamp   uint32
+	ssrc        uint32
+	payload     []byte
+}
+
+func parsePacket(t *testing.T, b []byte) packet {
+	if len(b) < HeaderSize || b[0] != rtpVersion<<6 {
+		t.Fatalf("invalid RTP packet % x", b)
+	}
+	return packet{
+		marker:      b[1]&0x80 != 0,
+		payloadType: b[1] & 0x7f,
+		seq:         binary.BigEndian.Uint16(b[2:]),
+		timestamp:   binary.BigEndian.Uint32(b[4:]),
+		ssrc:        binary.BigEndian.Uint32(b[8:]),
+		payload:     append([]byte(nil), b[HeaderSize:]...),
+	}
+}
+
+// packetRecorder keeps the packets written
+type packetRecorder [][]byte
+
+func (r *packetRecorder) Write(b []byte) (int, error) {
+	*r = append(*r, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// frame returns an MPEG1 Layer III 128kbps 44100Hz frame, header is
+// 0xff 0xfb 0x90 0x44 for stereo and 0xff 0xfb 0x90 0xc4 for mono
+func frame(header []byte, index int) mp3.Frame {
+	h, _ := mp3.ParseHeader(header)
+	data := make([]byte, h.Size())
+	copy(data, header)
+	data[len(data)-1] = byte(index)
+	return mp3.Frame{
+		Header: h,
+		Data:   data,
+		Index:  int64(index),
+		PTS:    int64(index * h.Samples()),
+	}
+}
+
+func TestPacketizerUDP(t *testing.T) {
+	ln, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err := net.Dial("udp", ln.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	p := NewPacketizer(conn, Config{SSRC: 0xdeadbeef, Sequence: 65535, Timestamp: 1000, FramesPerPacket: 2})
+	var frames []mp3.Frame
+	for i := 0; i < 5; i++ {
+		f := frame([]byte{0xff, 0xfb, 0x90, 0x44}, i)
+		frames = append(frames, f)
+		if err := p.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	// two packets of two frames and the last frame flushed
+	for i, seq := range []uint16{65535, 0, 1} {
+		n, err := ln.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkt := parsePacket(t, buf[:n])
+		if pkt.marker != (i == 0) || pkt.payloadType != PayloadTypeMPA || pkt.seq != seq || pkt.ssrc != 0xdeadbeef {
+			t.Errorf("packet %d: unexpected header %+v", i, pkt)
+		}
+		// 1152 samples at 44100Hz are 2351.02 ticks of 90kHz
+		if expected := uint32(1000 + i*2*1152*ClockRate/44100); pkt.timestamp != expected {
+			t.Errorf("packet %d: timestamp is %d, expected %d", i, pkt.timestamp, expected)
+		}
+		expected := []byte{0, 0, 0, 0}
+		for j := i * 2; j < i*2+2 && j < len(frames); j++ {
+			expected = append(expected, frames[j].Data...)
+		}
+		if !bytes.Equal(pkt.payload, expected) {
+			t.Errorf("packet %d: unexpected payload of %d bytes", i, len(pkt.payload))
+		}
+	}
+}
+
+func TestPacketizerFragments(t *testing.T) {
+	var packets packetRecorder
+	p := NewPacketizer(&packets, Config{MTU: 200, FramesPerPacket: 4})
+	f := frame([]byte{0xff, 0xfb, 0x90, 0x44}, 0)
+	p.WriteFrame(f)
+
+	// 417 bytes are sent in fragments of 184
+	if len(packets) != 3 {
+		t.Fatalf("expected 3 fragments, got %d", len(packets))
+	}
+	var data []byte
+	for i, b := range packets {
+		pkt := parsePacket(t, b)
+		offset := binary.BigEndian.Uint16(pkt.payload[2:])
+		if pkt.timestamp != 0 || int(offset) != len(data) || len(b) > 200 {
+			t.Errorf("fragment %d: timestamp %d, offset %d, size %d", i, pkt.timestamp, offset, len(b))
+		}
+		data = append(data, pkt.payload[mpaHeaderSize:]...)
+	}
+	if !bytes.Equal(data, f.Data) {
+		t.Error("fragments don't make up the frame")
+	}
+}
+
+func TestPacketizerSamplerateChange(t *testing.T) {
+	var packets packetRecorder
+	p := NewPacketizer(&packets, Config{})
+	p.WriteFrame(frame([]byte{0xff, 0xfb, 0x90, 0x44}, 0))
+	// MPEG1 48000Hz
+	p.WriteFrame(frame([]byte{0xff, 0xfb, 0x94, 0x44}, 1))
+	p.WriteFrame(frame([]byte{0xff, 0xfb, 0x94, 0x44}, 2))
+
+	timestamps := []uint32{0, 2351, 2351 + 2160}
+	for i, b := range packets {
+		if pkt := parsePacket(t, b); pkt.timestamp != timestamps[i] {
+			t.Errorf("packet %d: timestamp is %d, expected %d", i, pkt.timestamp, timestamps[i])
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package lame
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/viert/go-lame/id3"
+)
+
+const structTagName = "id3"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// tagField is a parsed id3 struct tag
+//  id3:"TIT2"                      text frame
+//  id3:"TXXX:MusicBrainz Album Id" user defined text or URL frame with a description
+//  id3:"TRCK/total"                total part of a "n/total" frame, e.g. number of tracks
+//  id3:"-"                         field is ignored
+type tagField struct {
+	name        string
+	frameID     string
+	description string
+	total       bool
+}
+
+func parseTagField(f reflect.StructField) (tagField, bool) {
+	tag, ok := f.Tag.Lookup(structTagName)
+	if !ok || tag == "-" || f.PkgPath != "" {
+		return tagField{}, false
+	}
+	tf := tagField{name: f.Name}
+	if strings.HasSuffix(tag, "/total") {
+		tf.total = true
+		tag = strings.TrimSuffix(tag, "/total")
+	}
+	if i := strings.IndexByte(tag, ':'); i >= 0 {
+		tf.description = tag[i+1:]
+		tag = tag[:i]
+	}
+	tf.frameID = tag
+	return tf, true
+}
+
+func (tf tagField) validate() error {
+	if len(tf.frameID) != 4 || strings.ToUpper(tf.frameID) != tf.frameID {
+		return fmt.Errorf("field %s: invalid frame id %q", tf.name, tf.frameID)
+	}
+	if tf.total && tf.frameID != "TRCK" && tf.frameID != "TPOS" {
+		return fmt.Errorf("field %s: total is only supported for TRCK and TPOS", tf.name)
+	}
+	return nil
+}
+
+type numberPair struct {
+	n     int64
+	total int64
+}
+
+func (p numberPair) String() string {
+	if p.total > 0 {
+		return fmt.Sprintf("%d/%d", p.n, p.total)
+	}
+	return strconv.FormatInt(p.n, 10)
+}
+
+// ApplyTags sets id3 tag fields of the encoder from a struct using id3 struct tags
+//  Fields are tagged with a frame id, e.g.
+//
+//    type Track struct {
+//        Title       string    `id3:"TIT2"`
+//        Number      int       `id3:"TRCK"`
+//        TotalTracks int       `id3:"TRCK/total"`
+//        Released    time.Time `id3:"TYER"`
+//        Cover       []byte    `id3:"APIC"`
+//        AlbumID     string    `id3:"TXXX:MusicBrainz Album Id"`
+//    }
+//
+//  Supported field types are strings, integers, time.Time (only the year is used)
+//  and []byte for APIC front cover images. Zero values are skipped.
+//  Title, artist, album, year, comment, track and genre are set with
+//  the corresponding ID3TagSet* methods so they go to the version 1 tag too,
+//  other frames are set with ID3TagSetFrame.
+func ApplyTags(enc *Encoder, v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("ApplyTags expects a struct, got %T", v)
+	}
+
+	numbers := make(map[string]numberPair)
+	var order []string
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tf, ok := parseTagField(rt.Field(i))
+		if !ok {
+			continue
+		}
+		if err := tf.validate(); err != nil {
+			return err
+		}
+		fv := rv.Field(i)
+
+		switch {
+		case isInt(fv.Kind()) || isUint(fv.Kind()):
+			n := intValue(fv)
+			if n == 0 {
+				continue
+			}
+			if tf.frameID == "TRCK" || tf.frameID == "TPOS" {
+				pair, found := numbers[tf.frameID]
+				if !found {
+					order = append(order, tf.frameID)
+				}
+				if tf.total {
+					pair.total = n
+				} else {
+					pair.n = n
+				}
+				numbers[tf.frameID] = pair
+				continue
+			}
+			if err := enc.setID3Value(tf, strconv.FormatInt(n, 10)); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.String:
+			if fv.String() == "" {
+				continue
+			}
+			if err := enc.setID3Value(tf, fv.String()); err != nil {
+				return err
+			}
+		case fv.Type() == timeType:
+			t := fv.Interface().(time.Time)
+			if t.IsZero() {
+				continue
+			}
+			if err := enc.setID3Value(tf, strconv.Itoa(t.Year())); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8:
+			if tf.frameID != "APIC" {
+				return fmt.Errorf("field %s: []byte is only supported for APIC", tf.name)
+			}
+			if fv.Len() == 0 {
+				continue
+			}
+			data := fv.Bytes()
+			enc.ID3TagSetFrame(&id3.PictureFrame{
+				MIMEType:    http.DetectContentType(data),
+				PictureType: id3.PictureFrontCover,
+				Data:        data,
+			})
+		default:
+			return fmt.Errorf("field %s: unsupported type %s", tf.name, fv.Type())
+		}
+	}
+
+	for _, id := range order {
+		pair := numbers[id]
+		if pair.n == 0 {
+			continue
+		}
+		if err := enc.setID3Value(tagField{frameID: id}, pair.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setID3Value sets a single text value to a frame
+func (e *Encoder) setID3Value(tf tagField, value string) error {
+	switch tf.frameID {
+	case "TIT2":
+		e.ID3TagSetTitle(value)
+	case "TPE1":
+		e.ID3TagSetArtist(value)
+	case "TALB":
+		e.ID3TagSetAlbum(value)
+	case "TYER", "TDRC":
+		e.ID3TagSetYear(value)
+	case "COMM":
+		e.ID3TagSetComment(value)
+	case "TRCK":
+		return e.ID3TagSetTrack(value)
+	case "TCON":
+		// unknown genres are still written to version 2 tag
+		if err := e.ID3TagSetGenre(value); err != nil && err != ErrID3GenreOther {
+			return err
+		}
+	case "TXXX":
+		e.ID3TagSetFrame(&id3.UserTextFrame{Description: tf.description, Value: value})
+	case "WXXX":
+		e.ID3TagSetFrame(&id3.UserURLFrame{Description: tf.description, URL: value})
+	case "WFED":
+		e.ID3TagSetPodcastFeedURL(value)
+	default:
+		switch tf.frameID[0] {
+		case 'T':
+			e.ID3TagSetFrame(&id3.TextFrame{FrameID: tf.frameID, Values: []string{value}})
+		case 'W':
+			e.ID3TagSetFrame(&id3.URLFrame{FrameID: tf.frameID, URL: value})
+		default:
+			return fmt.Errorf("field %s: unsupported frame %s", tf.name, tf.frameID)
+		}
+	}
+	return nil
+}
+
+// DecodeTags fills a struct from the id3 tags using id3 struct tags
+//  It's the reverse of ApplyTags, v must be a pointer to a struct.
+//  Title, artist, album, year, comment, track and genre fall back
+//  to the version 1 tag values if version 2 tag doesn't have them.
+//  Fields with no corresponding frame are left untouched.
+func DecodeTags(tag *id3.Tag, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("DecodeTags expects a pointer to struct, got %T", v)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		tf, ok := parseTagField(rt.Field(i))
+		if !ok {
+			continue
+		}
+		if err := tf.validate(); err != nil {
+			return err
+		}
+		fv := rv.Field(i)
+
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8 {
+			if tf.frameID != "APIC" {
+				return fmt.Errorf("field %s: []byte is only supported for APIC", tf.name)
+			}
+			if pic := frontCover(tag); pic != nil {
+				fv.SetBytes(pic.Data)
+			}
+			continue
+		}
+
+		value := id3Value(tag, tf)
+		if value == "" {
+			continue
+		}
+
+		switch {
+		case isInt(fv.Kind()) || isUint(fv.Kind()):
+			pair := parseNumberPair(value)
+			n := pair.n
+			if tf.total {
+				n = pair.total
+			}
+			if isInt(fv.Kind()) {
+				fv.SetInt(n)
+			} else if n >= 0 {
+				fv.SetUint(uint64(n))
+			}
+		case fv.Kind() == reflect.String:
+			fv.SetString(value)
+		case fv.Type() == timeType:
+			if t, ok := parseID3Time(value); ok {
+				fv.Set(reflect.ValueOf(t))
+			}
+		default:
+			return fmt.Errorf("field %s: unsupported type %s", tf.name, fv.Type())
+		}
+	}
+	return nil
+}
+
+// id3Value returns a single text value of a frame
+func id3Value(tag *id3.Tag, tf tagField) string {
+	switch tf.frameID {
+	case "TIT2":
+		return tag.Title()
+	case "TPE1":
+		return tag.Artist()
+	case "TALB":
+		return tag.Album()
+	case "COMM":
+		return tag.Comment()
+	case "TCON":
+		return tag.Genre()
+	case "TRCK":
+		if tag.V2 != nil && tag.V2.Text("TRCK") != "" {
+			return tag.V2.Text("TRCK")
+		}
+		if n := tag.Track(); n > 0 {
+			return strconv.Itoa(n)
+		}
+		return ""
+	case "TYER", "TDRC":
+		if tag.V2 != nil {
+			if value := tag.V2.Text(tf.frameID); value != "" {
+				return value
+			}
+		}
+		return tag.Year()
+	}
+
+	if tag.V2 == nil {
+		return ""
+	}
+	switch tf.frameID {
+	case "TXXX":
+		value, _ := tag.V2.UserText(tf.description)
+		return value
+	case "WXXX":
+		for _, f := range tag.V2.FramesByID("WXXX") {
+			if wxxx, ok := f.(*id3.UserURLFrame); ok && wxxx.Description == tf.description {
+				return wxxx.URL
+			}
+		}
+		return ""
+	}
+	switch f := tag.V2.Frame(tf.frameID).(type) {
+	case *id3.TextFrame:
+		return f.Text()
+	case *id3.URLFrame:
+		return f.URL
+	}
+	return ""
+}
+
+func frontCover(tag *id3.Tag) *id3.PictureFrame {
+	if tag.V2 == nil {
+		return nil
+	}
+	var first *id3.PictureFrame
+	for _, f := range tag.V2.FramesByID("APIC") {
+		if pic, ok := f.(*id3.PictureFrame); ok {
+			if pic.PictureType == id3.PictureFrontCover {
+				return pic
+			}
+			if first == nil {
+				first = pic
+			}
+		}
+	}
+	return first
+}
+
+func parseNumberPair(value string) numberPair {
+	var pair numberPair
+	parts := strings.SplitN(value, "/", 2)
+	pair.n, _ = strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if len(parts) > 1 {
+		pair.total, _ = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+	}
+	return pair
+}
+
+// id3 timestamp formats, ID3v2.4 allows any precision from year to seconds
+var id3TimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseID3Time(value string) (time.Time, bool) {
+	for _, layout := range id3TimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uint64
+}
+
+func intValue(v reflect.Value) int64 {
+	if isUint(v.Kind()) {
+		return int64(v.Uint())
+	}
+	return v.Int()
+}
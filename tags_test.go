@@ -0,0 +1,79 @@
+package lame
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/viert/go-lame/id3"
+)
+
+type catalogTrack struct {
+	Title       string    `id3:"TIT2"`
+	Artist      string    `id3:"TPE1"`
+	Composer    string    `id3:"TCOM"`
+	Number      int       `id3:"TRCK"`
+	TotalTracks int       `id3:"TRCK/total"`
+	Disc        uint8     `id3:"TPOS"`
+	Released    time.Time `id3:"TYER"`
+	AlbumID     string    `id3:"TXXX:MusicBrainz Album Id"`
+	Internal    string    `id3:"-"`
+}
+
+func TestApplyTags(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	track := catalogTrack{
+		Title:       "Super Song",
+		Artist:      "Super Artist",
+		Composer:    "Composer",
+		Number:      3,
+		TotalTracks: 12,
+		Disc:        1,
+		Released:    time.Date(1999, 5, 1, 0, 0, 0, 0, time.UTC),
+		AlbumID:     "f00-ba7",
+		Internal:    "not written",
+	}
+	if err := ApplyTags(enc, &track); err != nil {
+		t.Fatal(err)
+	}
+
+	v2, err := id3.ReadV2(bytes.NewReader(enc.ID3V2Tag()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := &id3.Tag{V2: v2}
+
+	var decoded catalogTrack
+	if err = DecodeTags(tag, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	track.Internal = ""
+	track.Released = time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)
+	if decoded != track {
+		t.Errorf("decoded %+v, expected %+v", decoded, track)
+	}
+}
+
+func TestApplyTagsErrors(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	if err := ApplyTags(enc, "string"); err == nil {
+		t.Error("non-struct value is expected to fail")
+	}
+
+	var badID struct {
+		Value string `id3:"title"`
+	}
+	badID.Value = "value"
+	if err := ApplyTags(enc, badID); err == nil {
+		t.Error("invalid frame id is expected to fail")
+	}
+
+	var badType struct {
+		Value float64 `id3:"TBPM"`
+	}
+	badType.Value = 120.5
+	if err := ApplyTags(enc, badType); err == nil {
+		t.Error("unsupported field type is expected to fail")
+	}
+}
@@ -0,0 +1,154 @@
+package lame
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/viert/go-lame/id3"
+)
+
+// version 1 tag field sizes
+const (
+	id3v1FieldSize        = 30
+	id3v1YearSize         = 4
+	id3v1TrackCommentSize = 28
+)
+
+// id3v2HeaderSize is the size of version 2 tag and frame headers
+const id3v2HeaderSize = 10
+
+// ID3WarningKind is a kind of metadata problem reported by ID3Warnings
+type ID3WarningKind int
+
+// ID3 warning kinds
+const (
+	// ID3WarningTruncated - the value doesn't fit the version 1 tag field
+	ID3WarningTruncated ID3WarningKind = iota
+	// ID3WarningTransliterated - the value has non-ASCII characters
+	// which can't be kept as is in the latin1 version 1 tag
+	ID3WarningTransliterated
+	// ID3WarningGenreOther - the genre is unknown to ID3v1 and set to "Other"
+	ID3WarningGenreOther
+	// ID3WarningFrameTooLarge - a frame or the whole version 2 tag exceeds its size limit
+	ID3WarningFrameTooLarge
+)
+
+// ID3Warning describes a metadata value which can't be written as is
+type ID3Warning struct {
+	Kind ID3WarningKind
+	// Field is a version 1 tag field name like "title" or a version 2 frame id
+	Field   string
+	Message string
+}
+
+func (w ID3Warning) String() string {
+	return w.Field + ": " + w.Message
+}
+
+// ID3Warnings reports metadata which is truncated, transliterated or can't be written
+//  Version 1 tag fields are checked against the 30 bytes limit (4 for year,
+//  28 for comment when a track is set) unless ID3TagV2Only is used.
+//  Version 2 frames set with ID3TagSetFrame and chapters are checked against
+//  the frame size limits. Nil is returned if everything fits.
+func (e *Encoder) ID3Warnings() []ID3Warning {
+	var warnings []ID3Warning
+	if !e.id3v2Only {
+		warnings = e.id3V1Warnings()
+	}
+	if !e.id3v1Only {
+		warnings = append(warnings, e.id3V2Warnings()...)
+	}
+	return warnings
+}
+
+func (e *Encoder) id3V1Warnings() []ID3Warning {
+	var warnings []ID3Warning
+	f := e.id3fields
+	commentSize := id3v1FieldSize
+	if f.track != "" {
+		commentSize = id3v1TrackCommentSize
+	}
+
+	check := func(field string, value string, size int) {
+		if len(value) > size {
+			warnings = append(warnings, ID3Warning{
+				Kind:    ID3WarningTruncated,
+				Field:   field,
+				Message: fmt.Sprintf("%d bytes truncated to %d in version 1 tag", len(value), size),
+			})
+		}
+		if !isASCII(value) {
+			warnings = append(warnings, ID3Warning{
+				Kind:    ID3WarningTransliterated,
+				Field:   field,
+				Message: "non-ASCII characters can't be kept in version 1 tag",
+			})
+		}
+	}
+	check("title", f.title, id3v1FieldSize)
+	check("artist", f.artist, id3v1FieldSize)
+	check("album", f.album, id3v1FieldSize)
+	check("year", f.year, id3v1YearSize)
+	check("comment", f.comment, commentSize)
+
+	if f.genreOther {
+		warnings = append(warnings, ID3Warning{
+			Kind:    ID3WarningGenreOther,
+			Field:   "genre",
+			Message: fmt.Sprintf("unknown genre %q set to \"Other\" in version 1 tag", f.genre),
+		})
+	}
+	return warnings
+}
+
+func (e *Encoder) id3V2Warnings() []ID3Warning {
+	var warnings []ID3Warning
+	version := byte(e.id3version)
+	for _, f := range e.customID3Frames() {
+		size, err := id3.FrameSize(f, version)
+		if err == nil && size > id3.MaxFrameSize {
+			err = fmt.Errorf("%d bytes exceed the frame size limit", size)
+		}
+		if err != nil {
+			warnings = append(warnings, ID3Warning{
+				Kind:    ID3WarningFrameTooLarge,
+				Field:   f.ID(),
+				Message: err.Error() + ", the tag can't be written",
+			})
+		}
+	}
+	if len(warnings) > 0 || !e.id3Managed() {
+		return warnings
+	}
+	// the tag size has the same 28 bits limit as the frame size
+	if e.id3V2Size() > id3.MaxFrameSize {
+		warnings = append(warnings, ID3Warning{
+			Kind:    ID3WarningFrameTooLarge,
+			Field:   "ID3v2",
+			Message: "the tag exceeds the size limit and can't be written",
+		})
+	}
+	return warnings
+}
+
+// id3V2Size returns the size of the version 2 tag without building it
+//  The frames lame makes of the fields are counted as the ones of ID3v2.4 tag.
+func (e *Encoder) id3V2Size() int {
+	version := byte(e.id3version)
+	size := id3v2HeaderSize + e.id3fields.padding
+	frames := append(e.fieldsID3V2Tag().Frames, e.customID3Frames()...)
+	for _, f := range frames {
+		n, _ := id3.FrameSize(f, version)
+		size += id3v2HeaderSize + n
+	}
+	return size
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
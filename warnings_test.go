@@ -0,0 +1,66 @@
+package lame
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/viert/go-lame/id3"
+)
+
+func TestID3Warnings(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	enc.ID3TagSetTitle("Short")
+	if warnings := enc.ID3Warnings(); warnings != nil {
+		t.Errorf("no warnings expected, got %v", warnings)
+	}
+
+	enc.ID3TagSetTitle("A title which is way too long for ID3v1")
+	enc.ID3TagSetArtist("Мумий Тролль")
+	enc.ID3TagSetComment("Exactly twenty nine bytes....")
+	if err := enc.ID3TagSetTrack("3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.ID3TagSetGenre("Some New Genre"); err != ErrID3GenreOther {
+		t.Fatalf("expected ErrID3GenreOther, got %v", err)
+	}
+	enc.ID3TagSetFrame(&id3.UniqueFileIDFrame{Owner: "http://example.com", Identifier: make([]byte, 100)})
+
+	found := make(map[string]ID3WarningKind)
+	for _, w := range enc.ID3Warnings() {
+		found[w.Field] = w.Kind
+	}
+	expected := map[string]ID3WarningKind{
+		"title":   ID3WarningTruncated,
+		"comment": ID3WarningTruncated,
+		"genre":   ID3WarningGenreOther,
+		"UFID":    ID3WarningFrameTooLarge,
+	}
+	for field, kind := range expected {
+		if k, ok := found[field]; !ok || k != kind {
+			t.Errorf("expected %s warning of kind %d", field, kind)
+		}
+	}
+	// artist fits but has Cyrillic characters
+	if found["artist"] != ID3WarningTransliterated {
+		t.Errorf("expected artist to be reported as transliterated")
+	}
+
+	enc.ID3TagV2Only()
+	for _, w := range enc.ID3Warnings() {
+		if w.Kind != ID3WarningFrameTooLarge {
+			t.Errorf("unexpected version 1 warning %s with ID3TagV2Only", w)
+		}
+	}
+}
+
+func TestID3WarningsTagSize(t *testing.T) {
+	enc := NewEncoder(ioutil.Discard)
+	defer enc.Close()
+	enc.ID3TagSetPrivate("com.example", []byte("data"))
+	enc.ID3TagSetPad(1 << 28)
+
+	warnings := enc.ID3Warnings()
+	if len(warnings) != 1 || warnings[0].Field != "ID3v2" || warnings[0].Kind != ID3WarningFrameTooLarge {
+		t.Errorf("expected the tag size warning, got %v", warnings)
+	}
+}